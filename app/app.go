@@ -3,9 +3,16 @@ package app
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
-	"os"
+	"io/fs"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/jtolds/pants2/ast"
 	"github.com/jtolds/pants2/interp"
@@ -14,15 +21,72 @@ import (
 type App struct {
 	defaultScope interp.Scope
 	builtins     map[string]func() (map[string]interp.Value, error)
+	sources      map[string][]byte
 	modules      map[string]map[string]*interp.ValueCell
+	searchPath   []string
+	importing    []importFrame
+	fs           fileSystem
+	manifest     *Manifest
+	cache        *Cache
+	vendored     map[string]string
+	named        map[string]bool
+	scopes       []moduleScope
+	messages     io.Writer
+	optimize     bool
+	parseCache   *ParseCache
+	limits       interp.Limits
+	held         int64
+	running      *running
+	interruptMtx sync.Mutex
+	interruption *interruption
+	policy       policy
 }
 
-func NewApp() (a *App) {
+// running is the context and budget of the code the App is running. Modules
+// imported while it runs share them.
+type running struct {
+	ctx    context.Context
+	budget *interp.Budget
+}
+
+// moduleScope is the top-level scope of a loaded module (key), the REPL or
+// the default scope (both with no key). These are the scopes whose imports
+// are rebound when a module is reloaded.
+type moduleScope struct {
+	key   string
+	scope *interp.FlatScope
+}
+
+// importFrame is a module that is in the middle of being loaded, along with
+// the import statement that caused it to load (nil for the top level).
+type importFrame struct {
+	key      string
+	filename string
+	from     *ast.Line
+}
+
+// NewApp creates an App. With no arguments, files are loaded from the
+// operating system. Otherwise, files are loaded from the first filesystem
+// given, and any further filesystems are overlays on top of it, with later
+// overlays taking precedence over earlier ones.
+func NewApp(filesystems ...fs.FS) (a *App) {
 	a = &App{
 		builtins: map[string]func() (map[string]interp.Value, error){},
+		sources:  map[string][]byte{},
 		modules:  map[string]map[string]*interp.ValueCell{},
+		named:    map[string]bool{},
+		fs:       osFileSystem{},
+		messages: io.Discard,
 	}
-	a.defaultScope = interp.NewFlatScope(interp.ModuleImporterFunc(a.importMod))
+	if len(filesystems) > 0 {
+		a.fs = &fsFileSystem{
+			base:     filesystems[0],
+			overlays: filesystems[1:],
+		}
+	}
+	s := interp.NewFlatScope(appImporter{a})
+	a.defaultScope = s
+	a.scopes = append(a.scopes, moduleScope{scope: s})
 	return a
 }
 
@@ -31,6 +95,115 @@ func (a *App) DefineModule(name string,
 	a.builtins[name] = initfn
 }
 
+// DefineModuleSource registers a module written in pants, such as one
+// embedded in the binary, to be loaded the first time something imports name.
+func (a *App) DefineModuleSource(name string, source []byte) {
+	a.sources[name] = source
+}
+
+// SetSearchPath sets the directories searched, in order, for imports that
+// are neither builtin modules nor found next to the importing file. Paths
+// starting with "./" or "../" are only ever resolved against the importing
+// file.
+func (a *App) SetSearchPath(dirs ...string) {
+	a.searchPath = append([]string(nil), dirs...)
+}
+
+// SetManifest makes imports of m's dependencies load them from the project's
+// vendor directory when it holds the required version, and otherwise from
+// the module cache, fetching them into it if needed. cache may be nil, in
+// which case only vendored dependencies can be imported. Manifests, vendor
+// directories and the cache are all on the operating system's filesystem, so
+// an App loading files from an fs.FS can't have one.
+func (a *App) SetManifest(m *Manifest, cache *Cache) error {
+	if _, ok := a.fs.(osFileSystem); !ok {
+		return fmt.Errorf(
+			"manifests need files loaded from the operating system, not an fs.FS")
+	}
+	vendored := map[string]string{}
+	fh, err := a.fs.open(a.fs.join(a.fs.join(m.Dir, vendorDir), vendorManifest))
+	if err == nil {
+		vendored, err = parseVendorManifest(fh)
+		fh.Close()
+		if err != nil {
+			return err
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	a.manifest, a.cache, a.vendored = m, cache, vendored
+	return nil
+}
+
+// SetMessages sets where reports meant for the person running the code, like
+// what a reload changed, are written. They are thrown away unless this is
+// called. LoadInteractive writes them to its output instead while it runs.
+func (a *App) SetMessages(w io.Writer) {
+	a.messages = w
+}
+
+// SetOptimize sets whether code is optimized before it runs, by folding
+// constant expressions and dropping code that can never run.
+func (a *App) SetOptimize(optimize bool) {
+	a.optimize = optimize
+}
+
+// SetParseCache makes modules that are loaded be parsed through c, so
+// modules that haven't changed aren't parsed again. c may be nil, which turns
+// the cache off.
+func (a *App) SetParseCache(c *ParseCache) {
+	a.parseCache = c
+}
+
+func (a *App) parse(filename string, input io.Reader) ([]ast.Stmt, error) {
+	if a.parseCache == nil {
+		return ast.ParseAll(ast.NewTokenSource(
+			ast.NewReaderLineSource(filename, input, nil)))
+	}
+	source, err := ioutil.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	return a.parseCache.Parse(filename, source)
+}
+
+// SetLimits sets the limits on running code. Each Load and LoadFile gets a
+// budget of its own, shared with the modules it imports, as does each
+// statement run interactively or by RunInDefaultScope. Values earlier runs
+// left in variables still count against the memory limit.
+func (a *App) SetLimits(limits interp.Limits) {
+	a.limits = limits
+}
+
+// begin starts running code with the given context, unless code is already
+// running. The returned function must be called when it is done.
+func (a *App) begin(ctx context.Context) (end func()) {
+	if a.running != nil {
+		return func() {}
+	}
+	b := interp.NewBudget(a.limits)
+	b.Hold(a.held)
+	a.running = &running{ctx: ctx, budget: b}
+	return func() {
+		a.held = b.Held()
+		a.running = nil
+	}
+}
+
+func (a *App) run(ctx context.Context, s interp.Scope,
+	stmts []ast.Stmt) error {
+	defer a.begin(ctx)()
+	if a.optimize {
+		// names are resolved before code that can never run is dropped, so
+		// mistakes in it are still reported
+		if err := interp.Check(s, stmts); err != nil {
+			return err
+		}
+		stmts = interp.Optimize(stmts)
+	}
+	return interp.RunContext(a.running.ctx, s, stmts, a.running.budget)
+}
+
 func (a *App) RunInDefaultScope(command string) error {
 	s := a.defaultScope
 	tokens := ast.NewTokenSource(ast.NewReaderLineSource("<builtin>",
@@ -43,7 +216,7 @@ func (a *App) RunInDefaultScope(command string) error {
 			}
 			return err
 		}
-		err = interp.Run(s, stmt)
+		err = a.run(context.Background(), s, []ast.Stmt{stmt})
 		if err != nil {
 			return err
 		}
@@ -52,32 +225,98 @@ func (a *App) RunInDefaultScope(command string) error {
 
 func (a *App) Load(name string, input io.Reader) (
 	map[string]*interp.ValueCell, error) {
-	if _, exists := a.modules[name]; exists {
-		return nil, fmt.Errorf("%#v already loaded", name)
+	return a.LoadContext(context.Background(), name, input)
+}
+
+// LoadContext is like Load, but stops with an *interp.LimitError when ctx is
+// done.
+func (a *App) LoadContext(ctx context.Context, name string, input io.Reader) (
+	map[string]*interp.ValueCell, error) {
+	defer a.begin(ctx)()
+	if _, exists := a.modules[name]; !exists {
+		a.named[name] = true
 	}
-	a.modules[name] = nil
-	s := a.defaultScope.Flatten()
-	rv := s.Exports()
-	tokens := ast.NewTokenSource(ast.NewReaderLineSource(name, input, nil))
-	for {
-		stmt, err := ast.ParseStatement(tokens)
+	rv, err := a.load(name, name, nil, input, nil)
+	if err != nil && a.modules[name] == nil {
+		delete(a.named, name)
+	}
+	return rv, err
+}
+
+// load runs a module's source. If reuse is not nil, the module's top-level
+// definitions of those names store their values in the given cells.
+func (a *App) load(key, filename string, from *ast.Line, input io.Reader,
+	reuse map[string]*interp.ValueCell) (
+	_ map[string]*interp.ValueCell, err error) {
+	if _, exists := a.modules[key]; exists {
+		return nil, fmt.Errorf("%#v already loaded", filename)
+	}
+	a.modules[key] = nil
+	a.importing = append(a.importing, importFrame{
+		key:      key,
+		filename: filename,
+		from:     from,
+	})
+	defer func() {
+		a.importing = a.importing[:len(a.importing)-1]
 		if err != nil {
-			if err == io.EOF {
-				a.modules[name] = rv
-				return rv, nil
-			}
-			return nil, err
+			delete(a.modules, key)
 		}
-		err = interp.Run(s, stmt)
-		if err != nil {
-			return nil, err
+	}()
+	s := a.defaultScope.Flatten().(*interp.FlatScope)
+	if reuse != nil {
+		s.ReuseCells(reuse)
+	}
+	rv := s.Exports()
+	// parse the whole module first, so syntax errors and undefined names are
+	// reported before any of it runs
+	stmts, err := a.parse(filename, input)
+	if err != nil {
+		return nil, err
+	}
+	err = a.run(context.Background(), s, stmts)
+	if err != nil {
+		return nil, err
+	}
+	a.modules[key] = rv
+	a.dropScope(key)
+	a.scopes = append(a.scopes, moduleScope{key: key, scope: s})
+	return rv, nil
+}
+
+// dropScope stops tracking the top-level scope of the module with the given
+// key.
+func (a *App) dropScope(key string) {
+	for i, ms := range a.scopes {
+		if ms.key == key {
+			a.scopes = append(a.scopes[:i], a.scopes[i+1:]...)
+			return
+		}
+	}
+}
+
+// forgetScope stops tracking the top-level scope s, once nothing more will
+// run in it.
+func (a *App) forgetScope(s *interp.FlatScope) {
+	for i, ms := range a.scopes {
+		if ms.scope == s {
+			a.scopes = append(a.scopes[:i], a.scopes[i+1:]...)
+			return
 		}
 	}
 }
 
+// LoadInteractive runs statements from input as they are typed, prompting on
+// output. Errors, and the reports of any modules reloaded, are written to
+// output too. Interrupt stops the statement running, and the next one is
+// read as usual.
 func (a *App) LoadInteractive(input io.Reader, output io.Writer) (
 	map[string]*interp.ValueCell, error) {
-	s := a.defaultScope.Flatten()
+	s := a.defaultScope.Flatten().(*interp.FlatScope)
+	a.scopes = append(a.scopes, moduleScope{scope: s})
+	defer a.forgetScope(s)
+	defer func(messages io.Writer) { a.messages = messages }(a.messages)
+	a.messages = output
 	rv := s.Exports()
 	tokens := ast.NewTokenSource(ast.NewReaderLineSource("<stdin>", input,
 		func() error {
@@ -100,12 +339,18 @@ func (a *App) LoadInteractive(input io.Reader, output io.Writer) (
 			tokens.ResetLine()
 			continue
 		}
-		err = interp.Run(s, stmt)
+		ctx, done := a.interruptible()
+		err = a.run(ctx, s, []ast.Stmt{stmt})
+		done()
 		if err != nil {
 			if !interp.IsHandledError(err) {
 				return nil, err
 			}
-			_, err = fmt.Fprintln(output, err)
+			msg := err.Error()
+			if tb := interp.Traceback(err); tb != "" {
+				msg += "\n" + tb
+			}
+			_, err = fmt.Fprintln(output, msg)
 			if err != nil {
 				return nil, err
 			}
@@ -115,27 +360,191 @@ func (a *App) LoadInteractive(input io.Reader, output io.Writer) (
 }
 
 func (a *App) LoadFile(path string) (map[string]*interp.ValueCell, error) {
-	fh, err := os.Open(path)
+	return a.LoadFileContext(context.Background(), path)
+}
+
+// LoadFileContext is like LoadFile, but stops with an *interp.LimitError when
+// ctx is done.
+func (a *App) LoadFileContext(ctx context.Context, path string) (
+	map[string]*interp.ValueCell, error) {
+	defer a.begin(ctx)()
+	filename, key, err := a.fs.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+	return a.loadFile(filename, key, nil, nil)
+}
+
+func (a *App) loadFile(filename, key string, from *ast.Line,
+	reuse map[string]*interp.ValueCell) (map[string]*interp.ValueCell, error) {
+	fh, err := a.fs.open(key)
 	if err != nil {
 		return nil, err
 	}
 	defer fh.Close()
-	return a.Load(path, bufio.NewReader(fh))
+	return a.load(key, filename, from, bufio.NewReader(fh), reuse)
 }
 
-func (a *App) importMod(path string) (map[string]*interp.ValueCell, error) {
-	if rv, exists := a.modules[path]; exists {
-		if rv == nil {
-			// TODO
-			return nil, fmt.Errorf("import cycle detected")
+func isExplicitlyRelative(path string) bool {
+	path = filepath.ToSlash(path)
+	return path == "." || path == ".." ||
+		strings.HasPrefix(path, "./") || strings.HasPrefix(path, "../")
+}
+
+// findFile resolves an import path to a filename and its canonical key.
+// Relative imports are resolved against the directory of the importing file,
+// falling back to the search path for paths that don't start with "./" or
+// "../". Imports from something other than a file (the REPL, or a module
+// loaded through Load) are relative to the working directory.
+func (a *App) findFile(from *ast.Line, path string) (
+	filename, key string, err error) {
+	var candidates []string
+	if a.fs.isAbs(path) {
+		candidates = append(candidates, path)
+	} else {
+		dir := "."
+		if from != nil {
+			dir = a.fs.dir(from.Filename)
+		}
+		candidates = append(candidates, a.fs.join(dir, path))
+		if !isExplicitlyRelative(path) {
+			for _, dir := range a.searchPath {
+				candidates = append(candidates, a.fs.join(dir, path))
+			}
 		}
-		return rv, nil
 	}
+	// candidates outside the policy's directories aren't looked for, and
+	// the module is only reported missing if one inside them was
+	var notAllowed error
+	looked := false
+	for _, candidate := range candidates {
+		if err := a.policy.checkName(a.fs, candidate); err != nil {
+			if notAllowed == nil {
+				notAllowed = err
+			}
+			continue
+		}
+		looked = true
+		filename, key, err := a.fs.resolve(candidate)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return "", "", err
+		}
+		return filename, key, nil
+	}
+	if !looked && notAllowed != nil {
+		return "", "", notAllowed
+	}
+	return "", "", fmt.Errorf("Module %#v not found", path)
+}
+
+// findDependency resolves an import path that names one of the manifest's
+// dependencies.
+func (a *App) findDependency(path string) (filename, key string, found bool,
+	err error) {
+	if a.manifest == nil {
+		return "", "", false, nil
+	}
+	req, rest, found := a.manifest.lookup(path)
+	if !found {
+		return "", "", false, nil
+	}
+	var dir string
+	if a.vendored[req.Name] == req.Version {
+		dir = a.fs.join(a.fs.join(a.manifest.Dir, vendorDir), req.Name)
+	} else {
+		if a.cache == nil {
+			return "", "", false, fmt.Errorf(
+				"Dependency %#v version %s is not vendored", req.Name, req.Version)
+		}
+		dir, err = a.cache.Fetch(req, a.manifest.Dir)
+		if err != nil {
+			return "", "", false, err
+		}
+	}
+	name := a.fs.join(dir, rest)
+	if err := a.policy.checkName(a.fs, name); err != nil {
+		return "", "", false, err
+	}
+	filename, key, err = a.fs.resolve(name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", "", false, fmt.Errorf(
+				"Module %#v not found in dependency %#v version %s",
+				path, req.Name, req.Version)
+		}
+		return "", "", false, err
+	}
+	return filename, key, true, nil
+}
+
+// appImporter lets the App's scopes import and reload modules.
+type appImporter struct{ a *App }
+
+func (i appImporter) Import(from *ast.Line, path string) (
+	map[string]*interp.ValueCell, error) {
+	return i.a.importMod(from, path)
+}
+
+func (i appImporter) Reload(from *ast.Line, path string) error {
+	return i.a.reloadMod(from, path)
+}
+
+// moduleSource is where an imported module comes from: a builtin module, a
+// module registered with DefineModuleSource, a file, or, if none of those are
+// set, a module loaded by name with Load.
+type moduleSource struct {
+	key      string
+	filename string
+	builtin  func() (map[string]interp.Value, error)
+	source   []byte
+	file     bool
+}
+
+func (a *App) findModule(from *ast.Line, path string) (moduleSource, error) {
 	if bi, exists := a.builtins[path]; exists {
-		vals, err := bi()
+		if err := a.policy.checkModule(path); err != nil {
+			return moduleSource{}, err
+		}
+		return moduleSource{key: path, filename: path, builtin: bi}, nil
+	}
+	if source, exists := a.sources[path]; exists {
+		if err := a.policy.checkModule(path); err != nil {
+			return moduleSource{}, err
+		}
+		return moduleSource{key: path, filename: path, source: source}, nil
+	}
+	if a.named[path] {
+		return moduleSource{key: path, filename: path}, nil
+	}
+	filename, key, found, err := a.findDependency(path)
+	if err != nil {
+		return moduleSource{}, err
+	}
+	if !found {
+		filename, key, err = a.findFile(from, path)
+		if err != nil {
+			return moduleSource{}, err
+		}
+	}
+	err = a.policy.checkFile(a.fs, filename, key)
+	if err != nil {
+		return moduleSource{}, err
+	}
+	return moduleSource{key: key, filename: filename, file: true}, nil
+}
+
+func (a *App) loadModule(mod moduleSource, from *ast.Line,
+	reuse map[string]*interp.ValueCell) (map[string]*interp.ValueCell, error) {
+	switch {
+	case mod.builtin != nil:
+		vals, err := mod.builtin()
 		if err != nil {
 			return nil, err
 		}
+		a.guard(vals)
 		cells := make(map[string]*interp.ValueCell, len(vals))
 		for name, val := range vals {
 			cells[name] = &interp.ValueCell{
@@ -143,8 +552,149 @@ func (a *App) importMod(path string) (map[string]*interp.ValueCell, error) {
 				Val: val,
 			}
 		}
-		a.modules[path] = cells
+		a.modules[mod.key] = cells
 		return cells, nil
+	case mod.source != nil:
+		return a.load(mod.key, mod.filename, from, bytes.NewReader(mod.source),
+			reuse)
+	case mod.file:
+		return a.loadFile(mod.filename, mod.key, from, reuse)
+	default:
+		panic(fmt.Sprintf("module %#v has no source", mod.key))
+	}
+}
+
+func (a *App) importMod(from *ast.Line, path string) (
+	map[string]*interp.ValueCell, error) {
+	mod, err := a.findModule(from, path)
+	if err != nil {
+		return nil, err
+	}
+	if rv, exists := a.modules[mod.key]; exists {
+		if rv == nil {
+			return nil, a.cycleError(from, mod.key)
+		}
+		return rv, nil
+	}
+	return a.loadModule(mod, from, nil)
+}
+
+// reloadMod re-executes an imported module. The module's new top-level
+// definitions reuse the cells of its old exports, so live imports of them
+// see the new values, and the top-level scopes that imported it bind any
+// names it now exports for the first time and unbind any it no longer
+// exports. A report of what changed is written to the App's messages.
+func (a *App) reloadMod(from *ast.Line, path string) error {
+	mod, err := a.findModule(from, path)
+	if err != nil {
+		return err
+	}
+	old, exists := a.modules[mod.key]
+	if !exists {
+		return fmt.Errorf("Module %#v not imported", path)
+	}
+	if old == nil {
+		return fmt.Errorf("Module %#v can't be reloaded while it is loading",
+			path)
+	}
+	if mod.builtin != nil {
+		return fmt.Errorf("Builtin module %#v can't be reloaded", path)
+	}
+	if mod.source == nil && !mod.file {
+		return fmt.Errorf("Module %#v has no file to reload it from", path)
+	}
+	// the new values are stored in the old cells as the module runs, so if
+	// it fails they are put back the way they were
+	saved := make(map[*interp.ValueCell]interp.ValueCell, len(old))
+	for _, cell := range old {
+		saved[cell] = *cell
+	}
+	delete(a.modules, mod.key)
+	next, err := a.loadModule(mod, from, old)
+	if err != nil {
+		for cell, was := range saved {
+			*cell = was
+		}
+		a.modules[mod.key] = old
+		return err
+	}
+
+	// keep the old exports map, since IMPORT ... AS namespaces refer to it
+	var added, removed, changed []string
+	for name := range old {
+		if _, exists := next[name]; !exists {
+			removed = append(removed, name)
+			delete(old, name)
+		}
+	}
+	for name, cell := range next {
+		if was, existed := old[name]; !existed {
+			added = append(added, name)
+		} else if !interp.Unchanged(saved[was].Val, cell.Val) {
+			changed = append(changed, name)
+		}
+		old[name] = cell
+	}
+	a.modules[mod.key] = old
+
+	reloaded := func(stmt *ast.StmtImport) bool {
+		m, err := a.findModule(stmt.Token.Line, stmt.Path.Val)
+		return err == nil && m.key == mod.key
+	}
+	for _, ms := range a.scopes {
+		ms.scope.Reimport(reloaded, old)
+	}
+	// every scope the App runs is flattened from the default one, so they
+	// all share its blocks
+	a.defaultScope.(*interp.FlatScope).ReimportBlocks(reloaded, old)
+
+	_, err = fmt.Fprintln(a.messages, reloadReport(path, added, removed, changed))
+	return err
+}
+
+func reloadReport(path string, added, removed, changed []string) string {
+	var parts []string
+	for _, part := range []struct {
+		what  string
+		names []string
+	}{{"added", added}, {"removed", removed}, {"changed", changed}} {
+		if len(part.names) > 0 {
+			sort.Strings(part.names)
+			parts = append(parts, part.what+" "+strings.Join(part.names, ", "))
+		}
+	}
+	if len(parts) == 0 {
+		return fmt.Sprintf("Reloaded %#v: no changes", path)
+	}
+	return fmt.Sprintf("Reloaded %#v: %s", path, strings.Join(parts, "; "))
+}
+
+// cycleError describes the chain of imports that leads from the module
+// identified by key back to itself, ending with the import statement on from.
+func (a *App) cycleError(from *ast.Line, key string) error {
+	start := len(a.importing)
+	for i, frame := range a.importing {
+		if frame.key == key {
+			start = i
+			break
+		}
+	}
+	frames := a.importing[start:]
+	if len(frames) == 0 {
+		return fmt.Errorf("import cycle detected on %#v", key)
+	}
+	names := make([]string, 0, len(frames)+1)
+	steps := make([]string, 0, len(frames))
+	for i, frame := range frames {
+		names = append(names, frame.filename)
+		stmt := from
+		if i+1 < len(frames) {
+			stmt = frames[i+1].from
+		}
+		steps = append(steps, fmt.Sprintf("\n  file %#v, line %d: %s",
+			stmt.Filename, stmt.Lineno, strings.TrimSpace(stmt.Line)))
 	}
-	return a.LoadFile(path)
+	names = append(names, frames[0].filename)
+	return fmt.Errorf("Import cycle detected: %s%s",
+		strings.Join(names, " -> "), strings.Join(steps, ""))
 }
@@ -0,0 +1,129 @@
+package app
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// fileSystem is where an App finds the files it loads.
+type fileSystem interface {
+	// resolve returns the filename to report name as, and the key identifying
+	// the file it refers to. The error satisfies errors.Is(err,
+	// fs.ErrNotExist) if there is no such file.
+	resolve(name string) (filename, key string, err error)
+	// lexical is like resolve, but works from name alone, without looking
+	// for the file or following symlinks. Its path is a key if there are no
+	// symlinks along the way.
+	lexical(name string) (filename, path string, err error)
+	open(key string) (io.ReadCloser, error)
+	isAbs(name string) bool
+	dir(name string) string
+	join(dir, name string) string
+	// contains reports whether the file key is in the directory dir, also a
+	// key, or in a directory under it.
+	contains(dir, key string) bool
+}
+
+// osFileSystem is the operating system's filesystem. Keys are absolute,
+// symlink-free paths, so one file reached through different relative paths
+// is only loaded once.
+type osFileSystem struct{}
+
+func (f osFileSystem) resolve(name string) (filename, key string, err error) {
+	filename, abs, err := f.lexical(name)
+	if err != nil {
+		return "", "", err
+	}
+	key, err = filepath.EvalSymlinks(abs)
+	if err != nil {
+		return "", "", err
+	}
+	return filename, key, nil
+}
+
+func (osFileSystem) lexical(name string) (filename, path string, err error) {
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return "", "", err
+	}
+	return filepath.Clean(name), abs, nil
+}
+
+func (osFileSystem) open(key string) (io.ReadCloser, error) {
+	return os.Open(key)
+}
+
+func (osFileSystem) isAbs(name string) bool       { return filepath.IsAbs(name) }
+func (osFileSystem) dir(name string) string       { return filepath.Dir(name) }
+func (osFileSystem) join(dir, name string) string { return filepath.Join(dir, name) }
+
+func (osFileSystem) contains(dir, key string) bool {
+	rel, err := filepath.Rel(dir, key)
+	return err == nil && rel != ".." &&
+		!strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// fsFileSystem is an io/fs.FS, with overlays that take precedence over it.
+// Names are slash-separated and relative to the root of the filesystem; a
+// leading slash is allowed and ignored.
+type fsFileSystem struct {
+	base     fs.FS
+	overlays []fs.FS
+}
+
+func (f *fsFileSystem) layers() []fs.FS {
+	layers := make([]fs.FS, 0, len(f.overlays)+1)
+	for i := len(f.overlays) - 1; i >= 0; i-- {
+		layers = append(layers, f.overlays[i])
+	}
+	return append(layers, f.base)
+}
+
+func (f *fsFileSystem) resolve(name string) (filename, key string, err error) {
+	_, key, _ = f.lexical(name)
+	for _, layer := range f.layers() {
+		_, err := fs.Stat(layer, key)
+		if err == nil {
+			return key, key, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", "", err
+		}
+	}
+	return "", "", &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+}
+
+func (f *fsFileSystem) lexical(name string) (filename, key string,
+	err error) {
+	key = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if key == "" {
+		key = "."
+	}
+	return key, key, nil
+}
+
+func (f *fsFileSystem) open(key string) (io.ReadCloser, error) {
+	for _, layer := range f.layers() {
+		fh, err := layer.Open(key)
+		if err == nil {
+			return fh, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return nil, &fs.PathError{Op: "open", Path: key, Err: fs.ErrNotExist}
+}
+
+func (f *fsFileSystem) isAbs(name string) bool       { return path.IsAbs(name) }
+func (f *fsFileSystem) dir(name string) string       { return path.Dir(name) }
+func (f *fsFileSystem) join(dir, name string) string { return path.Join(dir, name) }
+
+func (f *fsFileSystem) contains(dir, key string) bool {
+	return dir == "." || key == dir || strings.HasPrefix(key, dir+"/")
+}
@@ -0,0 +1,60 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrInterrupted is the error of the context of a statement stopped by
+// Interrupt.
+var ErrInterrupted = errors.New("interrupted")
+
+// interruption is a context that is done once it is interrupted.
+type interruption struct {
+	context.Context
+	done chan struct{}
+	once sync.Once
+}
+
+func (i *interruption) Done() <-chan struct{} { return i.done }
+
+func (i *interruption) Err() error {
+	select {
+	case <-i.done:
+		return ErrInterrupted
+	default:
+		return nil
+	}
+}
+
+func (i *interruption) interrupt() {
+	i.once.Do(func() { close(i.done) })
+}
+
+// Interrupt stops the statement LoadInteractive is running, if there is one.
+// It may be called from any goroutine, such as one handling SIGINT.
+func (a *App) Interrupt() {
+	a.interruptMtx.Lock()
+	defer a.interruptMtx.Unlock()
+	if a.interruption != nil {
+		a.interruption.interrupt()
+	}
+}
+
+// interruptible returns a context for running a statement that Interrupt
+// stops, and a function to call once the statement is done.
+func (a *App) interruptible() (ctx context.Context, done func()) {
+	i := &interruption{
+		Context: context.Background(),
+		done:    make(chan struct{}),
+	}
+	a.interruptMtx.Lock()
+	a.interruption = i
+	a.interruptMtx.Unlock()
+	return i, func() {
+		a.interruptMtx.Lock()
+		a.interruption = nil
+		a.interruptMtx.Unlock()
+	}
+}
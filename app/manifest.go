@@ -0,0 +1,159 @@
+package app
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	ManifestName = "pants.mod"
+
+	// a dependency imported by name alone loads this file from its root
+	dependencyEntry = "init.p"
+)
+
+// Manifest is a parsed pants.mod file, which names the modules a project
+// depends on. It looks like:
+//
+//	# comments start with a hash
+//	module classroom/games
+//	require shapes 1.2.0 ../shared/shapes
+//	require colors 0.3.1 /srv/pants/colors-0.3.1.zip
+//
+// Each requirement gives the dependency's import name, its version, and
+// where to copy it from: a directory, or a .zip, .tar, .tar.gz or .tgz
+// archive. Relative sources are relative to the manifest's directory.
+type Manifest struct {
+	Dir      string
+	Module   string
+	Requires []Require
+}
+
+type Require struct {
+	Name    string
+	Version string
+	Source  string
+}
+
+// ReadManifest reads the pants.mod file at path.
+func ReadManifest(path string) (*Manifest, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+	return ParseManifest(filepath.Dir(path), fh)
+}
+
+// FindManifest looks for a pants.mod file in dir and each of its parents,
+// returning nil if there isn't one.
+func FindManifest(dir string) (*Manifest, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		m, err := ReadManifest(filepath.Join(dir, ManifestName))
+		if err == nil {
+			return m, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+// ParseManifest parses a pants.mod file that lives in dir.
+func ParseManifest(dir string, r io.Reader) (*Manifest, error) {
+	m := &Manifest{Dir: dir}
+	seen := map[string]bool{}
+	scanner := bufio.NewScanner(r)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "module":
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("%s, line %d: expected \"module <name>\"",
+					ManifestName, lineno)
+			}
+			m.Module = fields[1]
+		case "require":
+			if len(fields) != 4 {
+				return nil, fmt.Errorf(
+					"%s, line %d: expected \"require <name> <version> <source>\"",
+					ManifestName, lineno)
+			}
+			req := Require{Name: fields[1], Version: fields[2], Source: fields[3]}
+			if !validDependencyName(req.Name) {
+				return nil, fmt.Errorf("%s, line %d: invalid dependency name %#v",
+					ManifestName, lineno, req.Name)
+			}
+			if strings.ContainsAny(req.Version, `/\@`) {
+				return nil, fmt.Errorf("%s, line %d: invalid version %#v",
+					ManifestName, lineno, req.Version)
+			}
+			if seen[req.Name] {
+				return nil, fmt.Errorf("%s, line %d: %#v required more than once",
+					ManifestName, lineno, req.Name)
+			}
+			seen[req.Name] = true
+			m.Requires = append(m.Requires, req)
+		default:
+			return nil, fmt.Errorf("%s, line %d: unknown directive %#v",
+				ManifestName, lineno, fields[0])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func validDependencyName(name string) bool {
+	if name == "" || strings.ContainsAny(name, `\@`) || path.IsAbs(name) {
+		return false
+	}
+	for _, elem := range strings.Split(name, "/") {
+		if elem == "" || elem == "." || elem == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// lookup finds the dependency an import path refers to, and the path of the
+// file within it. The longest matching dependency name wins.
+func (m *Manifest) lookup(importPath string) (req Require, rest string,
+	found bool) {
+	for _, r := range m.Requires {
+		if importPath != r.Name && !strings.HasPrefix(importPath, r.Name+"/") {
+			continue
+		}
+		if found && len(r.Name) <= len(req.Name) {
+			continue
+		}
+		req, found = r, true
+		rest = strings.TrimPrefix(strings.TrimPrefix(importPath, r.Name), "/")
+	}
+	if found && rest == "" {
+		rest = dependencyEntry
+	}
+	return req, rest, found
+}
@@ -0,0 +1,301 @@
+package app
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	vendorDir      = "vendor"
+	vendorManifest = "modules.txt"
+)
+
+// DefaultCacheDir is where dependencies are cached unless something else is
+// asked for: $PANTS2CACHE if it is set, or else a pants2 directory in the
+// user's cache directory.
+func DefaultCacheDir() (string, error) {
+	if dir := os.Getenv("PANTS2CACHE"); dir != "" {
+		return dir, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "pants2", "mod"), nil
+}
+
+// Cache is an on-disk directory of unpacked dependencies, one directory per
+// name and version. Entries are never changed once they exist.
+type Cache struct {
+	Dir string
+}
+
+func (c *Cache) entry(req Require) string {
+	return filepath.Join(c.Dir, filepath.FromSlash(req.Name)+"@"+req.Version)
+}
+
+// Fetch makes sure the given dependency is in the cache, copying it from its
+// source if needed, and returns the directory it is in. Relative sources are
+// relative to dir.
+func (c *Cache) Fetch(req Require, dir string) (string, error) {
+	target := c.entry(req)
+	if fi, err := os.Stat(target); err == nil && fi.IsDir() {
+		return target, nil
+	}
+	source := filepath.FromSlash(req.Source)
+	if !filepath.IsAbs(source) {
+		source = filepath.Join(dir, source)
+	}
+	err := os.MkdirAll(filepath.Dir(target), 0755)
+	if err != nil {
+		return "", err
+	}
+	tmp, err := ioutil.TempDir(filepath.Dir(target), ".fetch-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+	root, err := unpack(source, filepath.Join(tmp, "src"))
+	if err != nil {
+		return "", fmt.Errorf("fetching %s %s: %v", req.Name, req.Version, err)
+	}
+	err = os.Rename(root, target)
+	if err != nil {
+		if fi, serr := os.Stat(target); serr == nil && fi.IsDir() {
+			// someone else fetched it first
+			return target, nil
+		}
+		return "", err
+	}
+	return target, nil
+}
+
+// Vendor copies every dependency m requires into the vendor directory next
+// to the manifest, replacing whatever was there, and records their versions
+// in vendor/modules.txt. The new vendor directory is built on the side, so if
+// anything goes wrong the old one is left as it was.
+func Vendor(m *Manifest, c *Cache) error {
+	tmp, err := ioutil.TempDir(m.Dir, ".vendor-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	next := filepath.Join(tmp, vendorDir)
+	var list strings.Builder
+	list.WriteString("# generated by pants2 mod vendor; do not edit\n")
+	for _, req := range m.Requires {
+		src, err := c.Fetch(req, m.Dir)
+		if err != nil {
+			return err
+		}
+		err = copyDir(src, filepath.Join(next, filepath.FromSlash(req.Name)))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&list, "%s %s\n", req.Name, req.Version)
+	}
+	err = os.MkdirAll(next, 0755)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(filepath.Join(next, vendorManifest),
+		[]byte(list.String()), 0644)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Join(m.Dir, vendorDir)
+	old := filepath.Join(tmp, "old")
+	err = os.Rename(dir, old)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	err = os.Rename(next, dir)
+	if err != nil {
+		if rerr := os.Rename(old, dir); rerr != nil && !os.IsNotExist(rerr) {
+			return fmt.Errorf("%v (and restoring the old vendor directory: %v)",
+				err, rerr)
+		}
+		return err
+	}
+	return nil
+}
+
+// parseVendorManifest reads vendor/modules.txt, returning the vendored
+// version of each dependency.
+func parseVendorManifest(r io.Reader) (map[string]string, error) {
+	versions := map[string]string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 2 {
+			versions[fields[0]] = fields[1]
+		}
+	}
+	return versions, scanner.Err()
+}
+
+// unpack copies a directory or extracts an archive into dst, returning the
+// root of what was unpacked. An archive holding nothing but a single
+// directory has that directory as its root.
+func unpack(source, dst string) (root string, err error) {
+	fi, err := os.Stat(source)
+	if err != nil {
+		return "", err
+	}
+	if fi.IsDir() {
+		return dst, copyDir(source, dst)
+	}
+	switch name := strings.ToLower(source); {
+	case strings.HasSuffix(name, ".zip"):
+		err = unzip(source, dst)
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		err = untar(source, dst, true)
+	case strings.HasSuffix(name, ".tar"):
+		err = untar(source, dst, false)
+	default:
+		return "", fmt.Errorf("unknown archive type: %s", source)
+	}
+	if err != nil {
+		return "", err
+	}
+	entries, err := ioutil.ReadDir(dst)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 1 && entries[0].IsDir() {
+		return filepath.Join(dst, entries[0].Name()), nil
+	}
+	return dst, nil
+}
+
+// archivePath turns the name of an archive entry into a path under dst,
+// refusing entries that would end up outside of it.
+func archivePath(dst, name string) (string, error) {
+	clean := path.Clean("/" + strings.Replace(name, `\`, "/", -1))
+	if clean == "/" {
+		return "", fmt.Errorf("invalid archive entry: %#v", name)
+	}
+	return filepath.Join(dst, filepath.FromSlash(clean[1:])), nil
+}
+
+func writeFile(dst string, r io.Reader) error {
+	err := os.MkdirAll(filepath.Dir(dst), 0755)
+	if err != nil {
+		return err
+	}
+	fh, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(fh, r)
+	if err != nil {
+		fh.Close()
+		return err
+	}
+	return fh.Close()
+}
+
+func unzip(source, dst string) error {
+	zr, err := zip.OpenReader(source)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+		target, err := archivePath(dst, f.Name)
+		if err != nil {
+			return err
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		err = writeFile(target, rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return os.MkdirAll(dst, 0755)
+}
+
+func untar(source string, dst string, gzipped bool) error {
+	fh, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+	var r io.Reader = fh
+	if gzipped {
+		gr, err := gzip.NewReader(fh)
+		if err != nil {
+			return err
+		}
+		defer gr.Close()
+		r = gr
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return os.MkdirAll(dst, 0755)
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		target, err := archivePath(dst, hdr.Name)
+		if err != nil {
+			return err
+		}
+		err = writeFile(target, tr)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// copyDir copies the regular files under src to dst.
+func copyDir(src, dst string) error {
+	err := os.MkdirAll(dst, 0755)
+	if err != nil {
+		return err
+	}
+	return filepath.Walk(src, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		fh, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer fh.Close()
+		return writeFile(filepath.Join(dst, rel), fh)
+	})
+}
@@ -0,0 +1,85 @@
+package app
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/jtolds/pants2/ast"
+)
+
+// DefaultParseCacheDir is where parsed modules are cached unless something
+// else is asked for: $PANTS2PARSECACHE if it is set, or else a pants2
+// directory in the user's cache directory.
+func DefaultParseCacheDir() (string, error) {
+	if dir := os.Getenv("PANTS2PARSECACHE"); dir != "" {
+		return dir, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "pants2", "parse"), nil
+}
+
+// ParseCache is an on-disk directory of parsed modules, keyed by a hash of
+// their filename and source, so modules that haven't changed since they were
+// last parsed don't need parsing again.
+type ParseCache struct {
+	Dir string
+}
+
+func (c *ParseCache) entry(filename string, source []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d\n%s\n", ast.EncodingVersion, filename)
+	h.Write(source)
+	key := hex.EncodeToString(h.Sum(nil))
+	return filepath.Join(c.Dir, key[:2], key)
+}
+
+// Parse parses source, which came from filename, using the cached result if
+// there is one. Sources with syntax errors aren't cached.
+func (c *ParseCache) Parse(filename string, source []byte) ([]ast.Stmt, error) {
+	entry := c.entry(filename, source)
+	if data, err := ioutil.ReadFile(entry); err == nil {
+		if stmts, err := ast.Decode(data); err == nil {
+			return stmts, nil
+		}
+	}
+	stmts, err := ast.ParseAll(ast.NewTokenSource(
+		ast.NewReaderLineSource(filename, bytes.NewReader(source), nil)))
+	if err != nil {
+		return nil, err
+	}
+	// failing to save the entry only means parsing again next time
+	_ = c.save(entry, ast.Encode(stmts))
+	return stmts, nil
+}
+
+func (c *ParseCache) save(entry string, data []byte) error {
+	err := os.MkdirAll(filepath.Dir(entry), 0755)
+	if err != nil {
+		return err
+	}
+	fh, err := ioutil.TempFile(filepath.Dir(entry), ".save-")
+	if err != nil {
+		return err
+	}
+	_, err = fh.Write(data)
+	if err == nil {
+		err = fh.Close()
+	} else {
+		fh.Close()
+	}
+	if err == nil {
+		err = os.Rename(fh.Name(), entry)
+	}
+	if err != nil {
+		os.Remove(fh.Name())
+	}
+	return err
+}
@@ -0,0 +1,188 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jtolds/pants2/ast"
+	"github.com/jtolds/pants2/interp"
+)
+
+// Policy restricts what the code an App runs may import and call, for
+// running code that isn't trusted. The zero Policy allows everything.
+type Policy struct {
+	// Modules lists the modules defined with DefineModule or
+	// DefineModuleSource that may be imported. If it is nil, any of them may
+	// be.
+	Modules []string
+	// Dirs lists the directories files may be imported from, along with the
+	// directories under them. If it is nil, files may be imported from
+	// anywhere; if it is empty but not nil, no files may be imported.
+	// Importing a file outside them fails the same way whether or not it
+	// exists, as does importing a symlink that leads outside them.
+	Dirs []string
+	// Disabled lists builtin procedures and functions, like "input" or
+	// "sleep", that fail when called instead of running. They apply to every
+	// module defined with DefineModule, including ones already imported.
+	Disabled []string
+}
+
+// policy is a Policy ready to check imports against.
+type policy struct {
+	modules map[string]bool
+	// dirs are the directories files may be imported from, as given, and
+	// dirKeys and dirPaths are their keys and lexical paths.
+	dirs     []string
+	dirKeys  []string
+	dirPaths []string
+	disabled map[string]bool
+}
+
+// SetPolicy restricts what code the App runs from now on may do. It applies
+// to imports, not to the modules and files the App is asked to load
+// directly. Every directory in p.Dirs must exist.
+func (a *App) SetPolicy(p Policy) error {
+	var rv policy
+	if p.Modules != nil {
+		rv.modules = map[string]bool{}
+		for _, name := range p.Modules {
+			rv.modules[name] = true
+		}
+	}
+	if p.Dirs != nil {
+		rv.dirs = []string{}
+		rv.dirKeys = []string{}
+		rv.dirPaths = []string{}
+		for _, dir := range p.Dirs {
+			filename, key, err := a.fs.resolve(dir)
+			if err != nil {
+				return err
+			}
+			_, path, err := a.fs.lexical(dir)
+			if err != nil {
+				return err
+			}
+			rv.dirs = append(rv.dirs, filename)
+			rv.dirKeys = append(rv.dirKeys, key)
+			rv.dirPaths = append(rv.dirPaths, path)
+		}
+	}
+	if len(p.Disabled) > 0 {
+		rv.disabled = map[string]bool{}
+		for _, name := range p.Disabled {
+			rv.disabled[name] = true
+		}
+	}
+	a.policy = rv
+	return nil
+}
+
+func (p *policy) checkModule(path string) error {
+	if p.modules != nil && !p.modules[path] {
+		return fmt.Errorf("Importing module %#v is not allowed", path)
+	}
+	return nil
+}
+
+// checkFile checks the file found at key, which name refers to, may be
+// imported.
+func (p *policy) checkFile(fs fileSystem, filename, key string) error {
+	if p.dirs == nil {
+		return nil
+	}
+	for _, dir := range p.dirKeys {
+		if fs.contains(dir, key) {
+			return nil
+		}
+	}
+	return p.notAllowed(filename)
+}
+
+// checkName checks name looks like it is in a directory files may be
+// imported from, before looking for the file, so that code can't find out
+// what is elsewhere from whether it exists. checkFile still needs to check
+// where symlinks lead once the file is found.
+func (p *policy) checkName(fs fileSystem, name string) error {
+	if p.dirs == nil {
+		return nil
+	}
+	filename, path, err := fs.lexical(name)
+	if err != nil {
+		return err
+	}
+	for i := range p.dirs {
+		if fs.contains(p.dirPaths[i], path) || fs.contains(p.dirKeys[i], path) {
+			return nil
+		}
+	}
+	return p.notAllowed(filename)
+}
+
+func (p *policy) notAllowed(filename string) error {
+	if len(p.dirs) == 0 {
+		return fmt.Errorf("Importing file %#v is not allowed", filename)
+	}
+	return fmt.Errorf(
+		"Importing file %#v is not allowed, only files in %s may be imported",
+		filename, strings.Join(p.dirs, ", "))
+}
+
+func errDisabled(name string) error {
+	return fmt.Errorf("%s is disabled by this App's policy", name)
+}
+
+// guard wraps the builtin procedures and functions among vals so they fail
+// when called while the App's policy disables them. Checking on every call
+// means the policy applies to modules imported before it was set, too.
+func (a *App) guard(vals map[string]interp.Value) {
+	for name, val := range vals {
+		switch val := val.(type) {
+		case *interp.UserProc, *interp.UserFunc:
+		case interp.ProcCtxCB:
+			name := name
+			vals[name] = interp.ProcCtxCB(
+				func(ctx context.Context, args []interp.Value) error {
+					if a.policy.disabled[name] {
+						return errDisabled(name)
+					}
+					return val(ctx, args)
+				})
+		case interp.ValProc:
+			vals[name] = guardedProc{a: a, name: name, proc: val}
+		case interp.ValFunc:
+			vals[name] = guardedFunc{a: a, name: name, fn: val}
+		}
+	}
+}
+
+type guardedProc struct {
+	a    *App
+	name string
+	proc interp.ValProc
+}
+
+func (g guardedProc) String() string { return g.proc.String() }
+
+func (g guardedProc) Call(t *ast.Token, args []interp.Value) error {
+	if g.a.policy.disabled[g.name] {
+		return errDisabled(g.name)
+	}
+	return g.proc.Call(t, args)
+}
+
+type guardedFunc struct {
+	a    *App
+	name string
+	fn   interp.ValFunc
+}
+
+func (g guardedFunc) String() string { return g.fn.String() }
+
+func (g guardedFunc) Call(t *ast.Token, args []interp.Value) (
+	interp.Value, error) {
+	if g.a.policy.disabled[g.name] {
+		return nil, errDisabled(g.name)
+	}
+	return g.fn.Call(t, args)
+}
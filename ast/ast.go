@@ -20,7 +20,6 @@ type Expr interface {
 type Var struct {
 	Token *Token
 	Expr  Expr
-	Depth int
 }
 
 func (v *Var) String() string { return v.Token.Val }
@@ -91,14 +90,45 @@ type StmtImport struct {
 	Token  *Token
 	Path   *ExprString
 	Prefix *Var
+	As     *Var
+	Select *Token
+	Names  []*ImportName
+	Mode   *Token
+}
+
+// ImportName is a single name picked out by IMPORT ... ONLY or IMPORT ... USE.
+// Alias is nil unless the name was renamed with AS.
+type ImportName struct {
+	Name  *Var
+	Alias *Var
+}
+
+func (n *ImportName) String() string {
+	if n.Alias == nil {
+		return n.Name.String()
+	}
+	return n.Name.String() + " as " + n.Alias.String()
 }
 
 func (s *StmtImport) String() string {
-	if s.Prefix == nil {
-		return fmt.Sprintf("import %s\n", s.Path.String())
+	rv := "import " + s.Path.String()
+	if s.Prefix != nil {
+		rv += " withprefix " + s.Prefix.String()
 	}
-	return fmt.Sprintf("import %s withprefix %s\n",
-		s.Path.String(), s.Prefix.String())
+	if s.As != nil {
+		rv += " as " + s.As.String()
+	}
+	if s.Select != nil {
+		names := make([]string, 0, len(s.Names))
+		for _, name := range s.Names {
+			names = append(names, name.String())
+		}
+		rv += " " + s.Select.Val + " " + strings.Join(names, ", ")
+	}
+	if s.Mode != nil {
+		rv += " " + s.Mode.Val
+	}
+	return rv + "\n"
 }
 
 type StmtUnimport struct {
@@ -110,6 +140,15 @@ func (s *StmtUnimport) String() string {
 	return fmt.Sprintf("unimport %s\n", s.Path.String())
 }
 
+type StmtReload struct {
+	Token *Token
+	Path  *ExprString
+}
+
+func (s *StmtReload) String() string {
+	return fmt.Sprintf("reload %s\n", s.Path.String())
+}
+
 type StmtUndefine struct {
 	Token *Token
 	Vars  []*Var
@@ -223,6 +262,7 @@ func (*StmtAssignment) statement() {}
 func (*StmtWhile) statement()      {}
 func (*StmtImport) statement()     {}
 func (*StmtUnimport) statement()   {}
+func (*StmtReload) statement()     {}
 func (*StmtUndefine) statement()   {}
 func (*StmtExport) statement()     {}
 func (*StmtFuncDef) statement()    {}
@@ -268,11 +308,10 @@ func (e *ExprBool) String() string {
 }
 
 type ExprOp struct {
-	Token  *Token
-	Left   Expr
-	Op     *Token
-	Right  Expr
-	Method func(t *Token, left, right Value) (Value, error)
+	Token *Token
+	Left  Expr
+	Op    *Token
+	Right Expr
 }
 
 func (e *ExprOp) String() string {
@@ -298,6 +337,16 @@ func (e *ExprIndex) String() string {
 	return fmt.Sprintf("%s[%s]", e.Object, e.Index)
 }
 
+type ExprMember struct {
+	Token  *Token
+	Object Expr
+	Member *Token
+}
+
+func (e *ExprMember) String() string {
+	return fmt.Sprintf("%s.%s", e.Object, e.Member.Val)
+}
+
 type ExprFuncCall struct {
 	Token *Token
 	Func  Expr
@@ -335,6 +384,7 @@ func (*ExprBool) expression()     {}
 func (*ExprOp) expression()       {}
 func (*ExprNot) expression()      {}
 func (*ExprIndex) expression()    {}
+func (*ExprMember) expression()   {}
 func (*ExprFuncCall) expression() {}
 func (*ExprNegative) expression() {}
 
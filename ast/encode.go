@@ -0,0 +1,622 @@
+package ast
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// EncodingVersion changes whenever the format Encode writes does, so saved
+// encodings from other versions can be told apart.
+const EncodingVersion = 1
+
+// Encode serializes parsed statements so they can be read back with Decode
+// instead of parsing their source again. Tokens and lines that are shared
+// between nodes stay shared.
+func Encode(stmts []Stmt) []byte {
+	e := &encoder{
+		strings: map[string]int{},
+		lines:   map[*Line]int{},
+		tokens:  map[*Token]int{},
+	}
+	e.stmts(stmts)
+	// the number of lines and tokens go first, so they can be allocated
+	// all at once
+	body := e.buf
+	e.buf = nil
+	e.uint(uint64(len(e.lines)))
+	e.uint(uint64(len(e.tokens)))
+	return append(e.buf, body...)
+}
+
+// Decode reads back statements serialized by Encode.
+func Decode(data []byte) (stmts []Stmt, err error) {
+	d := &decoder{data: data}
+	d.lines = make([]Line, 0, d.count())
+	d.tokens = make([]Token, 0, d.count())
+	stmts = d.stmts()
+	if d.err == nil && len(d.data) > 0 {
+		d.fail("trailing data")
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return stmts, nil
+}
+
+const (
+	_ byte = iota
+	kindIf
+	kindVar
+	kindAssignment
+	kindWhile
+	kindImport
+	kindUnimport
+	kindReload
+	kindUndefine
+	kindExport
+	kindFuncDef
+	kindProcDef
+	kindProcCall
+	kindControl
+	kindReturn
+)
+
+const (
+	_ byte = iota
+	kindExprVar
+	kindExprString
+	kindExprNumber
+	kindExprBool
+	kindExprOp
+	kindExprNot
+	kindExprIndex
+	kindExprMember
+	kindExprFuncCall
+	kindExprNegative
+)
+
+// Strings, lines and tokens are written once and then referred to by
+// number. 0 is nil, a number up to how many have been seen is one of those,
+// and the number after that is a new one, written out next.
+type encoder struct {
+	buf     []byte
+	strings map[string]int
+	lines   map[*Line]int
+	tokens  map[*Token]int
+}
+
+func (e *encoder) uint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	e.buf = append(e.buf, b[:binary.PutUvarint(b[:], v)]...)
+}
+
+func (e *encoder) int(v int64) {
+	var b [binary.MaxVarintLen64]byte
+	e.buf = append(e.buf, b[:binary.PutVarint(b[:], v)]...)
+}
+
+func (e *encoder) bool(v bool) {
+	if v {
+		e.buf = append(e.buf, 1)
+	} else {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *encoder) string(s string) {
+	if i, exists := e.strings[s]; exists {
+		e.uint(uint64(i + 1))
+		return
+	}
+	e.strings[s] = len(e.strings)
+	e.uint(uint64(len(e.strings)))
+	e.uint(uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *encoder) line(l *Line) {
+	if l == nil {
+		e.uint(0)
+		return
+	}
+	if i, exists := e.lines[l]; exists {
+		e.uint(uint64(i + 1))
+		return
+	}
+	e.lines[l] = len(e.lines)
+	e.uint(uint64(len(e.lines)))
+	e.string(l.Filename)
+	e.int(int64(l.Lineno))
+	e.string(l.Line)
+}
+
+func (e *encoder) token(t *Token) {
+	if t == nil {
+		e.uint(0)
+		return
+	}
+	if i, exists := e.tokens[t]; exists {
+		e.uint(uint64(i + 1))
+		return
+	}
+	e.tokens[t] = len(e.tokens)
+	e.uint(uint64(len(e.tokens)))
+	e.line(t.Line)
+	e.int(int64(t.Start))
+	e.int(int64(t.Length))
+	e.string(t.Type)
+	e.string(t.Val)
+}
+
+func (e *encoder) v(v *Var) {
+	e.bool(v != nil)
+	if v != nil {
+		e.token(v.Token)
+		e.expr(v.Expr)
+	}
+}
+
+func (e *encoder) vars(vars []*Var) {
+	e.uint(uint64(len(vars)))
+	for _, v := range vars {
+		e.v(v)
+	}
+}
+
+func (e *encoder) stmts(stmts []Stmt) {
+	e.uint(uint64(len(stmts)))
+	for _, stmt := range stmts {
+		e.stmt(stmt)
+	}
+}
+
+func (e *encoder) stmt(stmt Stmt) {
+	switch stmt := stmt.(type) {
+	case *StmtIf:
+		e.buf = append(e.buf, kindIf)
+		e.token(stmt.Token)
+		e.expr(stmt.Test)
+		e.stmts(stmt.Body)
+		e.stmts(stmt.Else)
+	case *StmtVar:
+		e.buf = append(e.buf, kindVar)
+		e.token(stmt.Token)
+		e.vars(stmt.Vars)
+	case *StmtAssignment:
+		e.buf = append(e.buf, kindAssignment)
+		e.token(stmt.Token)
+		e.v(stmt.Lhs)
+		e.expr(stmt.Rhs)
+	case *StmtWhile:
+		e.buf = append(e.buf, kindWhile)
+		e.token(stmt.Token)
+		e.expr(stmt.Test)
+		e.stmts(stmt.Body)
+	case *StmtImport:
+		e.buf = append(e.buf, kindImport)
+		e.token(stmt.Token)
+		e.expr(stmt.Path)
+		e.v(stmt.Prefix)
+		e.v(stmt.As)
+		e.token(stmt.Select)
+		e.uint(uint64(len(stmt.Names)))
+		for _, name := range stmt.Names {
+			e.v(name.Name)
+			e.v(name.Alias)
+		}
+		e.token(stmt.Mode)
+	case *StmtUnimport:
+		e.buf = append(e.buf, kindUnimport)
+		e.token(stmt.Token)
+		e.expr(stmt.Path)
+	case *StmtReload:
+		e.buf = append(e.buf, kindReload)
+		e.token(stmt.Token)
+		e.expr(stmt.Path)
+	case *StmtUndefine:
+		e.buf = append(e.buf, kindUndefine)
+		e.token(stmt.Token)
+		e.vars(stmt.Vars)
+	case *StmtExport:
+		e.buf = append(e.buf, kindExport)
+		e.token(stmt.Token)
+		e.vars(stmt.Vars)
+	case *StmtFuncDef:
+		e.buf = append(e.buf, kindFuncDef)
+		e.token(stmt.Token)
+		e.v(stmt.Name)
+		e.vars(stmt.Args)
+		e.stmts(stmt.Body)
+	case *StmtProcDef:
+		e.buf = append(e.buf, kindProcDef)
+		e.token(stmt.Token)
+		e.v(stmt.Name)
+		e.vars(stmt.Args)
+		e.stmts(stmt.Body)
+	case *StmtProcCall:
+		e.buf = append(e.buf, kindProcCall)
+		e.token(stmt.Token)
+		e.expr(stmt.Proc)
+		e.exprs(stmt.Args)
+	case *StmtControl:
+		e.buf = append(e.buf, kindControl)
+		e.token(stmt.Token)
+	case *StmtReturn:
+		e.buf = append(e.buf, kindReturn)
+		e.token(stmt.Token)
+		e.expr(stmt.Val)
+	default:
+		panic(fmt.Sprintf("unknown statement: %#v", stmt))
+	}
+}
+
+func (e *encoder) exprs(exprs []Expr) {
+	e.uint(uint64(len(exprs)))
+	for _, expr := range exprs {
+		e.expr(expr)
+	}
+}
+
+func (e *encoder) expr(expr Expr) {
+	switch expr := expr.(type) {
+	case nil:
+		e.buf = append(e.buf, 0)
+	case *ExprVar:
+		e.buf = append(e.buf, kindExprVar)
+		e.token(expr.Token)
+		e.v(expr.Var)
+	case *ExprString:
+		if expr == nil {
+			e.buf = append(e.buf, 0)
+			return
+		}
+		e.buf = append(e.buf, kindExprString)
+		e.token(expr.Token)
+		e.string(expr.Val)
+	case *ExprNumber:
+		e.buf = append(e.buf, kindExprNumber)
+		e.token(expr.Token)
+		// most numbers are small integers, which are quicker to read back
+		// as one
+		num := expr.Val.Num()
+		small := expr.Val.IsInt() && num.IsInt64()
+		e.bool(small)
+		if small {
+			e.int(num.Int64())
+		} else {
+			e.string(expr.Val.RatString())
+		}
+	case *ExprBool:
+		e.buf = append(e.buf, kindExprBool)
+		e.token(expr.Token)
+		e.bool(expr.Val)
+	case *ExprOp:
+		e.buf = append(e.buf, kindExprOp)
+		e.token(expr.Token)
+		e.expr(expr.Left)
+		e.token(expr.Op)
+		e.expr(expr.Right)
+	case *ExprNot:
+		e.buf = append(e.buf, kindExprNot)
+		e.token(expr.Token)
+		e.expr(expr.Expr)
+	case *ExprIndex:
+		e.buf = append(e.buf, kindExprIndex)
+		e.token(expr.Token)
+		e.expr(expr.Object)
+		e.expr(expr.Index)
+	case *ExprMember:
+		e.buf = append(e.buf, kindExprMember)
+		e.token(expr.Token)
+		e.expr(expr.Object)
+		e.token(expr.Member)
+	case *ExprFuncCall:
+		e.buf = append(e.buf, kindExprFuncCall)
+		e.token(expr.Token)
+		e.expr(expr.Func)
+		e.exprs(expr.Args)
+	case *ExprNegative:
+		e.buf = append(e.buf, kindExprNegative)
+		e.token(expr.Token)
+		e.expr(expr.Expr)
+	default:
+		panic(fmt.Sprintf("unknown expression: %#v", expr))
+	}
+}
+
+// decoder reads what an encoder wrote. Once something is wrong, err is set
+// and everything after that reads as zero values. Anything the parser always
+// fills in has to be there, so nothing using what Decode returns trips over
+// a nil.
+type decoder struct {
+	data    []byte
+	err     error
+	strings []string
+	lines   []Line
+	tokens  []Token
+}
+
+func (d *decoder) fail(msg string) {
+	if d.err == nil {
+		d.err = fmt.Errorf("corrupt encoding: %s", msg)
+		d.data = nil
+	}
+}
+
+func (d *decoder) uint() uint64 {
+	v, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		d.fail("bad number")
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *decoder) int() int {
+	v, n := binary.Varint(d.data)
+	if n <= 0 {
+		d.fail("bad number")
+		return 0
+	}
+	d.data = d.data[n:]
+	return int(v)
+}
+
+// count reads the length of a list. Every element takes at least a byte, so
+// a list can't be longer than what is left.
+func (d *decoder) count() int {
+	n := d.uint()
+	if n > uint64(len(d.data)) {
+		d.fail("bad length")
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) byte() byte {
+	if len(d.data) == 0 {
+		d.fail("unexpected end")
+		return 0
+	}
+	b := d.data[0]
+	d.data = d.data[1:]
+	return b
+}
+
+func (d *decoder) bool() bool { return d.byte() != 0 }
+
+// ref reads a reference to one of seen things, returning its index, or
+// seen if it is a new one, or -1 if it is nil.
+func (d *decoder) ref(seen int) int {
+	n := d.uint()
+	if n > uint64(seen)+1 {
+		d.fail("bad reference")
+		return -1
+	}
+	return int(n) - 1
+}
+
+func (d *decoder) string() string {
+	i := d.ref(len(d.strings))
+	switch {
+	case i < 0:
+		d.fail("bad string")
+		return ""
+	case i < len(d.strings):
+		return d.strings[i]
+	}
+	n := d.count()
+	s := string(d.data[:n])
+	d.data = d.data[n:]
+	d.strings = append(d.strings, s)
+	return s
+}
+
+func (d *decoder) line() *Line {
+	i := d.ref(len(d.lines))
+	switch {
+	case i < 0:
+		return nil
+	case i < len(d.lines):
+		return &d.lines[i]
+	case i == cap(d.lines):
+		d.fail("too many lines")
+		return nil
+	}
+	d.lines = append(d.lines, Line{})
+	l := &d.lines[i]
+	l.Filename = d.string()
+	l.Lineno = d.int()
+	l.Line = d.string()
+	return l
+}
+
+func (d *decoder) token() *Token {
+	t := d.optToken()
+	if t == nil {
+		d.fail("missing token")
+	}
+	return t
+}
+
+func (d *decoder) optToken() *Token {
+	i := d.ref(len(d.tokens))
+	switch {
+	case i < 0:
+		return nil
+	case i < len(d.tokens):
+		return &d.tokens[i]
+	case i == cap(d.tokens):
+		d.fail("too many tokens")
+		return nil
+	}
+	d.tokens = append(d.tokens, Token{})
+	t := &d.tokens[i]
+	t.Line = d.line()
+	if t.Line == nil {
+		d.fail("missing line")
+	}
+	t.Start = d.int()
+	t.Length = d.int()
+	t.Type = d.string()
+	t.Val = d.string()
+	return t
+}
+
+func (d *decoder) v() *Var {
+	v := d.optV()
+	if v == nil {
+		d.fail("missing variable")
+	}
+	return v
+}
+
+func (d *decoder) optV() *Var {
+	if !d.bool() {
+		return nil
+	}
+	return &Var{Token: d.token(), Expr: d.optExpr()}
+}
+
+func (d *decoder) vars() []*Var {
+	n := d.count()
+	if n == 0 {
+		return nil
+	}
+	vars := make([]*Var, 0, n)
+	for i := 0; i < n; i++ {
+		vars = append(vars, d.v())
+	}
+	return vars
+}
+
+func (d *decoder) stmts() []Stmt {
+	n := d.count()
+	if n == 0 {
+		return nil
+	}
+	stmts := make([]Stmt, 0, n)
+	for i := 0; i < n; i++ {
+		stmts = append(stmts, d.stmt())
+	}
+	return stmts
+}
+
+func (d *decoder) path() *ExprString {
+	path, ok := d.expr().(*ExprString)
+	if !ok {
+		d.fail("bad path")
+	}
+	return path
+}
+
+func (d *decoder) stmt() Stmt {
+	switch kind := d.byte(); kind {
+	case kindIf:
+		return &StmtIf{Token: d.token(), Test: d.expr(), Body: d.stmts(),
+			Else: d.stmts()}
+	case kindVar:
+		return &StmtVar{Token: d.token(), Vars: d.vars()}
+	case kindAssignment:
+		return &StmtAssignment{Token: d.token(), Lhs: d.v(), Rhs: d.expr()}
+	case kindWhile:
+		return &StmtWhile{Token: d.token(), Test: d.expr(), Body: d.stmts()}
+	case kindImport:
+		stmt := &StmtImport{Token: d.token(), Path: d.path(), Prefix: d.optV(),
+			As: d.optV(), Select: d.optToken()}
+		n := d.count()
+		for i := 0; i < n; i++ {
+			stmt.Names = append(stmt.Names,
+				&ImportName{Name: d.v(), Alias: d.optV()})
+		}
+		stmt.Mode = d.optToken()
+		return stmt
+	case kindUnimport:
+		return &StmtUnimport{Token: d.token(), Path: d.path()}
+	case kindReload:
+		return &StmtReload{Token: d.token(), Path: d.path()}
+	case kindUndefine:
+		return &StmtUndefine{Token: d.token(), Vars: d.vars()}
+	case kindExport:
+		return &StmtExport{Token: d.token(), Vars: d.vars()}
+	case kindFuncDef:
+		return &StmtFuncDef{Token: d.token(), Name: d.v(), Args: d.vars(),
+			Body: d.stmts()}
+	case kindProcDef:
+		return &StmtProcDef{Token: d.token(), Name: d.v(), Args: d.vars(),
+			Body: d.stmts()}
+	case kindProcCall:
+		return &StmtProcCall{Token: d.token(), Proc: d.expr(), Args: d.exprs()}
+	case kindControl:
+		return &StmtControl{Token: d.token()}
+	case kindReturn:
+		return &StmtReturn{Token: d.token(), Val: d.expr()}
+	default:
+		d.fail(fmt.Sprintf("unknown statement kind %d", kind))
+		return nil
+	}
+}
+
+func (d *decoder) exprs() []Expr {
+	n := d.count()
+	if n == 0 {
+		return nil
+	}
+	exprs := make([]Expr, 0, n)
+	for i := 0; i < n; i++ {
+		exprs = append(exprs, d.expr())
+	}
+	return exprs
+}
+
+func (d *decoder) expr() Expr {
+	expr := d.optExpr()
+	if expr == nil {
+		d.fail("missing expression")
+	}
+	return expr
+}
+
+func (d *decoder) optExpr() Expr {
+	switch kind := d.byte(); kind {
+	case 0:
+		return nil
+	case kindExprVar:
+		return &ExprVar{Token: d.token(), Var: d.v()}
+	case kindExprString:
+		return &ExprString{Token: d.token(), Val: d.string()}
+	case kindExprNumber:
+		expr := &ExprNumber{Token: d.token()}
+		if d.bool() {
+			v, n := binary.Varint(d.data)
+			if n <= 0 {
+				d.fail("bad number")
+				return nil
+			}
+			d.data = d.data[n:]
+			expr.Val.SetInt64(v)
+		} else if _, ok := expr.Val.SetString(d.string()); !ok {
+			d.fail("bad number")
+		}
+		return expr
+	case kindExprBool:
+		return &ExprBool{Token: d.token(), Val: d.bool()}
+	case kindExprOp:
+		return &ExprOp{Token: d.token(), Left: d.expr(), Op: d.token(),
+			Right: d.expr()}
+	case kindExprNot:
+		return &ExprNot{Token: d.token(), Expr: d.expr()}
+	case kindExprIndex:
+		return &ExprIndex{Token: d.token(), Object: d.expr(), Index: d.expr()}
+	case kindExprMember:
+		return &ExprMember{Token: d.token(), Object: d.expr(), Member: d.token()}
+	case kindExprFuncCall:
+		return &ExprFuncCall{Token: d.token(), Func: d.expr(), Args: d.exprs()}
+	case kindExprNegative:
+		return &ExprNegative{Token: d.token(), Expr: d.expr()}
+	default:
+		d.fail(fmt.Sprintf("unknown expression kind %d", kind))
+		return nil
+	}
+}
@@ -2,12 +2,15 @@ package ast
 
 import (
 	"fmt"
+	"strings"
+	"unicode"
 )
 
 type SyntaxError struct {
 	line    *Line
 	charpos int
 	msg     string
+	token   *Token
 }
 
 func NewSyntaxError(line *Line, charpos int,
@@ -21,15 +24,80 @@ func NewSyntaxError(line *Line, charpos int,
 
 func NewSyntaxErrorFromToken(token *Token,
 	format string, args ...interface{}) *SyntaxError {
-	return NewSyntaxError(token.Line, token.Start, format, args...)
+	err := NewSyntaxError(token.Line, token.Start, format, args...)
+	err.token = token
+	return err
 }
 
+// Pos returns where the error is: a filename, line number and character
+// offset into the line, both starting from 1.
+func (e *SyntaxError) Pos() (filename string, lineno, char int) {
+	return e.line.Filename, e.line.Lineno, e.charpos + 1
+}
+
+// Msg returns the error's description, without its position.
+func (e *SyntaxError) Msg() string { return e.msg }
+
 func (e *SyntaxError) Error() string {
-	return fmt.Sprintf("Syntax error on file %#v, line %d, character %d: %s",
-		e.line.Filename, e.line.Lineno, e.charpos+1, e.msg)
+	length := 1
+	if e.token != nil {
+		length = e.token.Length
+	}
+	return fmt.Sprintf("Syntax error on file %#v, line %d, character %d: %s%s",
+		e.line.Filename, e.line.Lineno, e.charpos+1, e.msg,
+		Snippet(e.line, e.charpos, length))
+}
+
+// Snippet renders line with carets under the length characters starting at
+// start, for appending to an error message. The line's indentation is left
+// out. It returns "" if there is no source text to show.
+func Snippet(line *Line, start, length int) string {
+	if line == nil || strings.TrimSpace(line.Line) == "" {
+		return ""
+	}
+	chars := []rune(line.Line)
+	indent := 0
+	for indent < len(chars) && unicode.IsSpace(chars[indent]) {
+		indent++
+	}
+	if start < indent {
+		start = indent
+	}
+	if start > len(chars) {
+		start = len(chars)
+	}
+	if length < 1 {
+		length = 1
+	}
+	var carets strings.Builder
+	for _, c := range chars[indent:start] {
+		if c == '\t' {
+			carets.WriteRune('\t')
+		} else {
+			carets.WriteRune(' ')
+		}
+	}
+	carets.WriteString(strings.Repeat("^", length))
+	return fmt.Sprintf("\n    %s\n    %s", string(chars[indent:]), carets.String())
+}
+
+// SyntaxErrors is every syntax error found in a program, in the order they
+// appear.
+type SyntaxErrors []*SyntaxError
+
+func (e SyntaxErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "\n")
 }
 
 func IsSyntaxError(err error) bool {
-	_, ok := err.(*SyntaxError)
-	return ok
+	switch err.(type) {
+	case *SyntaxError, SyntaxErrors:
+		return true
+	default:
+		return false
+	}
 }
@@ -2,8 +2,93 @@ package ast
 
 import (
 	"io"
+	"sort"
+	"strings"
 )
 
+// ParseAll parses every statement tokens has left, so a program can be
+// checked for syntax errors before any of it runs. Parsing carries on past
+// syntax errors (see recoverFrom), and every error found is returned as
+// SyntaxErrors.
+func ParseAll(tokens *TokenSource) ([]Stmt, error) {
+	tokens.recovering, tokens.errs = true, nil
+	defer func() { tokens.recovering, tokens.errs = false, nil }()
+	var stmts []Stmt
+	for {
+		stmt, err := ParseStatement(tokens)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			err = tokens.recoverFrom(err)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		stmts = append(stmts, stmt)
+	}
+	if len(tokens.errs) > 0 {
+		// errors on a line can be found both when it is tokenized and after
+		// the parser has moved on from it
+		errs := tokens.errs
+		sort.SliceStable(errs, func(i, j int) bool {
+			if errs[i].line.Lineno != errs[j].line.Lineno {
+				return errs[i].line.Lineno < errs[j].line.Lineno
+			}
+			return errs[i].charpos < errs[j].charpos
+		})
+		return nil, errs
+	}
+	return stmts, nil
+}
+
+// recoverFrom records a syntax error and skips ahead to where parsing can
+// start again: the end of the statement the error is in, which is the next
+// newline or ";" outside of any braces opened since the error, or just before
+// the "}" closing the block the statement is in, if it is in one. Other
+// errors, and syntax errors when not recovering, are returned as they are.
+func (t *TokenSource) recoverFrom(err error) error {
+	serr, ok := err.(*SyntaxError)
+	if !ok || !t.recovering {
+		return err
+	}
+	if n := len(t.errs); n == 0 || t.errs[n-1].line != serr.line {
+		// anything else wrong on the same line is likely just confusion
+		// caused by the first error
+		t.errs = append(t.errs, serr)
+	}
+	depth := 0
+	tok := serr.token
+	for {
+		if tok != nil {
+			switch tok.Type {
+			case "eof":
+				t.Push(tok)
+				return nil
+			case "{":
+				depth++
+			case "}":
+				if depth == 0 && t.blocks > 0 {
+					t.Push(tok)
+					return nil
+				}
+				if depth > 0 {
+					depth--
+				}
+			case "newline", ";":
+				if depth == 0 {
+					return nil
+				}
+			}
+		}
+		tok, err = t.NextToken()
+		if err != nil {
+			return err
+		}
+	}
+}
+
 func ParseStatement(tokens *TokenSource) (stmt Stmt, err error) {
 	var token *Token
 loop:
@@ -36,6 +121,8 @@ loop:
 				return parseImport(token, tokens)
 			case "unimport":
 				return parseUnimport(token, tokens)
+			case "reload":
+				return parseReload(token, tokens)
 			case "undefine":
 				return parseUndefine(token, tokens)
 			case "export":
@@ -138,60 +225,76 @@ func parseExprOrder2(tokens *TokenSource) (Expr, error) {
 	if err != nil {
 		return nil, err
 	}
-	tok, err := tokens.NextToken()
-	if err != nil {
-		return nil, err
-	}
-	switch tok.Type {
-	case "[": // index
-		idx, err := parseExpression(tokens, true)
-		if err != nil {
-			return nil, err
-		}
-		end, err := tokens.NextToken()
+	for {
+		tok, err := tokens.NextToken()
 		if err != nil {
 			return nil, err
 		}
-		if end.Type != "]" {
-			return nil, NewSyntaxErrorFromToken(end,
-				"Unexpected token %#v. Expecting closing brace \"]\".", end.Type)
-		}
-		return &ExprIndex{
-			Token:  tok,
-			Object: val,
-			Index:  idx,
-		}, nil
-	case "f(": // function call
-		var args []Expr
-		for {
-			end, err := tokens.NextToken()
+		switch tok.Type {
+		case "[": // index
+			idx, err := parseExpression(tokens, true)
 			if err != nil {
 				return nil, err
 			}
-			if end.Type == ")" {
-				break
+			end, err := tokens.NextToken()
+			if err != nil {
+				return nil, err
 			}
-			if len(args) == 0 {
-				tokens.Push(end)
-			} else if end.Type != "," {
+			if end.Type != "]" {
 				return nil, NewSyntaxErrorFromToken(end,
-					"Unexpected token %#v. Expecting closing parenthesis or comma.",
-					end.Type)
+					"Unexpected token %#v. Expecting closing brace \"]\".", end.Type)
+			}
+			val = &ExprIndex{
+				Token:  tok,
+				Object: val,
+				Index:  idx,
 			}
-			arg, err := parseExpression(tokens, true)
+		case ".": // member access
+			member, err := tokens.NextToken()
 			if err != nil {
 				return nil, err
 			}
-			args = append(args, arg)
+			if member.Type != "variable" {
+				return nil, NewSyntaxErrorFromToken(member,
+					"Unexpected token %#v. Expecting member name.", member.Type)
+			}
+			val = &ExprMember{
+				Token:  tok,
+				Object: val,
+				Member: member,
+			}
+		case "f(": // function call
+			var args []Expr
+			for {
+				end, err := tokens.NextToken()
+				if err != nil {
+					return nil, err
+				}
+				if end.Type == ")" {
+					break
+				}
+				if len(args) == 0 {
+					tokens.Push(end)
+				} else if end.Type != "," {
+					return nil, NewSyntaxErrorFromToken(end,
+						"Unexpected token %#v. Expecting closing parenthesis or comma.",
+						end.Type)
+				}
+				arg, err := parseExpression(tokens, true)
+				if err != nil {
+					return nil, err
+				}
+				args = append(args, arg)
+			}
+			val = &ExprFuncCall{
+				Token: tok,
+				Func:  val,
+				Args:  args,
+			}
+		default:
+			tokens.Push(tok)
+			return val, nil
 		}
-		return &ExprFuncCall{
-			Token: tok,
-			Func:  val,
-			Args:  args,
-		}, nil
-	default:
-		tokens.Push(tok)
-		return val, err
 	}
 }
 
@@ -287,6 +390,8 @@ func parseStatementBlock(tokens *TokenSource) (rv []Stmt, err error) {
 		return nil, NewSyntaxErrorFromToken(leftbrace,
 			"Unexpected token %#v. Expecting '{'", leftbrace.Type)
 	}
+	tokens.blocks++
+	defer func() { tokens.blocks-- }()
 	for {
 		var rightbrace *Token
 	loop:
@@ -305,10 +410,19 @@ func parseStatementBlock(tokens *TokenSource) (rv []Stmt, err error) {
 		if rightbrace.Type == "}" {
 			return rv, nil
 		}
+		if rightbrace.Type == "eof" {
+			return nil, NewSyntaxErrorFromToken(rightbrace,
+				"Unexpected end of file. Expecting '}' to close the block on "+
+					"line %d", leftbrace.Line.Lineno)
+		}
 		tokens.Push(rightbrace)
 		stmt, err := ParseStatement(tokens)
 		if err != nil {
-			return nil, err
+			err = tokens.recoverFrom(err)
+			if err != nil {
+				return nil, err
+			}
+			continue
 		}
 		rv = append(rv, stmt)
 	}
@@ -435,7 +549,9 @@ func parseWhile(start *Token, tokens *TokenSource) (Stmt, error) {
 	}, nil
 }
 
-// IMPORT <string> [WITHPREFIX <variable>]
+// IMPORT <string> [AS <variable> | WITHPREFIX <variable> | ONLY <names> |
+// USE <names>]
+// [READONLY | SNAPSHOT]
 func parseImport(start *Token, tokens *TokenSource) (Stmt, error) {
 	module, err := tokens.NextToken()
 	if err != nil {
@@ -445,40 +561,138 @@ func parseImport(start *Token, tokens *TokenSource) (Stmt, error) {
 		return nil, NewSyntaxErrorFromToken(module,
 			"Unexpected token %#v. Expecting module string", module.Type)
 	}
+	stmt := &StmtImport{
+		Token: start,
+		Path: &ExprString{
+			Token: module,
+			Val:   module.Val,
+		}}
 	next, err := tokens.NextToken()
 	if err != nil {
 		return nil, err
 	}
-	if next.Type != "keyword" || next.Val != "withprefix" {
-		tokens.Push(next)
-		return &StmtImport{
-			Token: start,
-			Path: &ExprString{
-				Token: module,
-				Val:   module.Val,
-			}}, nil
+	if importWord(next, "as", "only", "use") || next.Type == "keyword" {
+		switch next.Val {
+		case "as":
+			as, err := tokens.NextToken()
+			if err != nil {
+				return nil, err
+			}
+			if as.Type != "variable" {
+				return nil, NewSyntaxErrorFromToken(as,
+					"Unexpected token %#v. Expecting module name", as.Type)
+			}
+			stmt.As = &Var{Token: as}
+		case "withprefix":
+			prefix, err := tokens.NextToken()
+			if err != nil {
+				return nil, err
+			}
+			if prefix.Type != "variable" {
+				return nil, NewSyntaxErrorFromToken(prefix,
+					"Unexpected token %#v. Expecting module prefix", prefix.Type)
+			}
+			stmt.Prefix = &Var{Token: prefix}
+		case "only", "use":
+			stmt.Select = next
+			stmt.Names, err = parseImportNames(tokens, next.Val == "use")
+			if err != nil {
+				return nil, err
+			}
+		default:
+			tokens.Push(next)
+		}
+		next, err = tokens.NextToken()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if importWord(next, "readonly", "snapshot") {
+		stmt.Mode = next
+		return stmt, nil
+	}
+	tokens.Push(next)
+	return stmt, nil
+}
+
+// importWord reports whether t is one of words, which are only keywords
+// within an import statement and are otherwise free to use as names. If it
+// is, t is turned into the keyword.
+func importWord(t *Token, words ...string) bool {
+	if t.Type != "variable" {
+		return false
+	}
+	for _, word := range words {
+		if t.Val == word || t.Val == strings.ToUpper(word) {
+			t.Type, t.Val = "keyword", word
+			return true
+		}
+	}
+	return false
+}
+
+// <variable> [AS <variable>] (, <variable> [AS <variable>])*
+// (AS is only allowed for USE)
+func parseImportNames(tokens *TokenSource, aliases bool) (
+	[]*ImportName, error) {
+	var names []*ImportName
+	for {
+		name, err := tokens.NextToken()
+		if err != nil {
+			return nil, err
+		}
+		if name.Type != "variable" {
+			return nil, NewSyntaxErrorFromToken(name,
+				"Unexpected token %#v. Expecting variable", name.Type)
+		}
+		in := &ImportName{Name: &Var{Token: name}}
+		next, err := tokens.NextToken()
+		if err != nil {
+			return nil, err
+		}
+		if aliases && importWord(next, "as") {
+			alias, err := tokens.NextToken()
+			if err != nil {
+				return nil, err
+			}
+			if alias.Type != "variable" {
+				return nil, NewSyntaxErrorFromToken(alias,
+					"Unexpected token %#v. Expecting variable", alias.Type)
+			}
+			in.Alias = &Var{Token: alias}
+			next, err = tokens.NextToken()
+			if err != nil {
+				return nil, err
+			}
+		}
+		names = append(names, in)
+		if next.Type != "," {
+			tokens.Push(next)
+			return names, nil
+		}
 	}
-	prefix, err := tokens.NextToken()
+}
+
+// UNIMPORT <string>
+func parseUnimport(start *Token, tokens *TokenSource) (Stmt, error) {
+	module, err := tokens.NextToken()
 	if err != nil {
 		return nil, err
 	}
-	if prefix.Type != "variable" {
-		return nil, NewSyntaxErrorFromToken(prefix,
-			"Unexpected token %#v. Expecting module prefix", prefix.Type)
+	if module.Type != "string" {
+		return nil, NewSyntaxErrorFromToken(module,
+			"Unexpected token %#v. Expecting module string", module.Type)
 	}
-	return &StmtImport{
+	return &StmtUnimport{
 		Token: start,
 		Path: &ExprString{
 			Token: module,
 			Val:   module.Val,
-		},
-		Prefix: &Var{
-			Token: prefix,
 		}}, nil
 }
 
-// UNIMPORT <string>
-func parseUnimport(start *Token, tokens *TokenSource) (Stmt, error) {
+// RELOAD <string>
+func parseReload(start *Token, tokens *TokenSource) (Stmt, error) {
 	module, err := tokens.NextToken()
 	if err != nil {
 		return nil, err
@@ -487,7 +701,7 @@ func parseUnimport(start *Token, tokens *TokenSource) (Stmt, error) {
 		return nil, NewSyntaxErrorFromToken(module,
 			"Unexpected token %#v. Expecting module string", module.Type)
 	}
-	return &StmtUnimport{
+	return &StmtReload{
 		Token: start,
 		Path: &ExprString{
 			Token: module,
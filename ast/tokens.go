@@ -78,6 +78,16 @@ func (t *Tokenizer) Next() (*Token, error) {
 			Type:   "!="}, nil
 	}
 
+	if t.chars[t.charpos] == '.' && (t.charpos+1 >= len(t.chars) ||
+		!unicode.IsNumber(t.chars[t.charpos+1])) {
+		t.charpos += 1
+		return &Token{
+			Line:   t.line,
+			Start:  t.charpos - 1,
+			Length: 1,
+			Type:   "."}, nil
+	}
+
 	if unicode.IsNumber(t.chars[t.charpos]) || t.chars[t.charpos] == '.' {
 		start := t.charpos
 		decimal := false
@@ -117,16 +127,16 @@ func (t *Tokenizer) Next() (*Token, error) {
 		for t.charpos < len(t.chars) &&
 			(unicode.IsLetter(t.chars[t.charpos]) ||
 				unicode.IsNumber(t.chars[t.charpos]) ||
-				map[rune]bool{'.': true, '_': true}[t.chars[t.charpos]]) {
+				t.chars[t.charpos] == '_') {
 			t.charpos += 1
 		}
 		name := string(t.chars[start:t.charpos])
 		switch name {
 		case "if", "IF", "else", "ELSE", "var", "VAR", "loop", "LOOP",
 			"while", "WHILE", "import", "IMPORT", "unimport", "UNIMPORT",
-			"undefine", "UNDEFINE", "export", "EXPORT", "func", "FUNC",
-			"proc", "PROC", "break", "BREAK", "next", "NEXT", "done", "DONE",
-			"return", "RETURN", "withprefix", "WITHPREFIX":
+			"reload", "RELOAD", "undefine", "UNDEFINE", "export", "EXPORT",
+			"func", "FUNC", "proc", "PROC", "break", "BREAK", "next", "NEXT",
+			"done", "DONE", "return", "RETURN", "withprefix", "WITHPREFIX":
 			return &Token{
 				Line:   t.line,
 				Start:  start,
@@ -172,6 +182,8 @@ func (t *Tokenizer) parseString() (*Token, error) {
 	start := t.charpos
 	t.charpos += 1
 	value := make([]rune, 0, len(t.chars)-t.charpos)
+	// an unknown escape is reported once the whole string has been read
+	var badEscape *SyntaxError
 	for ; t.charpos < len(t.chars); t.charpos += 1 {
 		if t.chars[t.charpos] == '\\' {
 			t.charpos += 1
@@ -188,14 +200,19 @@ func (t *Tokenizer) parseString() (*Token, error) {
 			case 't':
 				value = append(value, '\t')
 			default:
-				return nil, NewSyntaxError(t.line, t.charpos-1,
-					"String escape value unknown: \\%v.\n"+
-						"Expected one of \\\\, \\\", \\n, \\t",
-					string(t.chars[t.charpos]))
+				if badEscape == nil {
+					badEscape = NewSyntaxError(t.line, t.charpos-1,
+						"String escape value unknown: \\%v.\n"+
+							"Expected one of \\\\, \\\", \\n, \\t",
+						string(t.chars[t.charpos]))
+				}
 			}
 			continue
 		} else if t.chars[t.charpos] == '"' {
 			t.charpos += 1
+			if badEscape != nil {
+				return nil, badEscape
+			}
 			return &Token{
 				Line:   t.line,
 				Start:  start,
@@ -207,6 +224,9 @@ func (t *Tokenizer) parseString() (*Token, error) {
 			value = append(value, t.chars[t.charpos])
 		}
 	}
+	if badEscape != nil {
+		return nil, badEscape
+	}
 	return nil, NewSyntaxError(t.line, start,
 		"String started but not ended.")
 }
@@ -219,6 +239,15 @@ func (t *Tokenizer) skipWhitespace() (skipped bool) {
 	return skipped
 }
 
+func newlineToken(line *Line) *Token {
+	return &Token{
+		Line:   line,
+		Start:  len(line.Line),
+		Length: 1,
+		Type:   "newline",
+	}
+}
+
 func Tokenize(line *Line) (rv []*Token, err error) {
 	tok := NewTokenizer(line)
 	for {
@@ -228,24 +257,48 @@ func Tokenize(line *Line) (rv []*Token, err error) {
 		}
 		if err != nil {
 			if err == io.EOF {
-				rv = append(rv, &Token{
-					Line:   line,
-					Start:  len(line.Line),
-					Length: 1,
-					Type:   "newline",
-				})
-				return rv, nil
+				return append(rv, newlineToken(line)), nil
 			}
 			return rv, err
 		}
 	}
 }
 
+// tokenizeAll is like Tokenize, but carries on past syntax errors by skipping
+// the characters they are about, returning them along with every token it
+// could make out.
+func tokenizeAll(line *Line) (rv []*Token, errs SyntaxErrors) {
+	tok := NewTokenizer(line)
+	for {
+		t, err := tok.Next()
+		if t != nil {
+			rv = append(rv, t)
+		}
+		if err != nil {
+			if err == io.EOF {
+				return append(rv, newlineToken(line)), errs
+			}
+			serr := err.(*SyntaxError)
+			errs = append(errs, serr)
+			if tok.charpos <= serr.charpos {
+				tok.charpos = serr.charpos + 1
+			}
+		}
+	}
+}
+
 type TokenSource struct {
 	ls     LineSource
 	tokens []*Token
 	pushed []*Token
 	end    bool
+
+	// recovering is set when parsing should carry on past syntax errors,
+	// which are collected in errs
+	recovering bool
+	errs       SyntaxErrors
+	// blocks is how many statement blocks are being parsed
+	blocks int
 }
 
 func NewTokenSource(ls LineSource) *TokenSource {
@@ -258,14 +311,14 @@ func (t *TokenSource) ResetLine() {
 }
 
 func (t *TokenSource) NextToken() (rv *Token, err error) {
-	if t.end {
-		return nil, io.EOF
-	}
 	if len(t.pushed) > 0 {
 		last := len(t.pushed) - 1
 		rv, t.pushed = t.pushed[last], t.pushed[:last]
 		return rv, nil
 	}
+	if t.end {
+		return nil, io.EOF
+	}
 	if len(t.tokens) == 0 {
 		line, err := t.ls.NextLine()
 		if err != nil {
@@ -282,11 +335,17 @@ func (t *TokenSource) NextToken() (rv *Token, err error) {
 			}
 			return nil, err
 		}
-		tokens, err := Tokenize(line)
-		if err != nil {
-			return nil, err
+		if t.recovering {
+			tokens, errs := tokenizeAll(line)
+			t.tokens = tokens
+			t.errs = append(t.errs, errs...)
+		} else {
+			tokens, err := Tokenize(line)
+			if err != nil {
+				return nil, err
+			}
+			t.tokens = tokens
 		}
-		t.tokens = tokens
 	}
 	rv, t.tokens = t.tokens[0], t.tokens[1:]
 	return rv, nil
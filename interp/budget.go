@@ -0,0 +1,250 @@
+package interp
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jtolds/pants2/ast"
+)
+
+// Limits bounds how much work running code may do. A zero field means no
+// limit, except for Depth.
+type Limits struct {
+	// Steps is how many statements may run. Every time around a loop counts
+	// as one too.
+	Steps int64
+	// Depth is how many procedure and function calls may be in progress at
+	// once. Zero means DefaultDepth: there is always some limit, as running
+	// out of stack kills the whole process.
+	Depth int
+	// Time is how long code may run for, starting from when the budget was
+	// made. Builtins that block, like sleep, are stopped at it too.
+	Time time.Duration
+	// Memory is roughly how many bytes the values held in variables may
+	// take altogether, and so any one value too. Arithmetic that would make
+	// a bigger string or number fails before making it, as does storing a
+	// value that would take variables over the limit.
+	Memory int64
+}
+
+// Budget keeps track of how much of its limits running code has used. Runs
+// that share a budget are limited together. A budget must not be used by
+// more than one run at a time.
+type Budget struct {
+	limits   Limits
+	steps    int64
+	depth    int
+	deadline time.Time
+	ctx      context.Context
+	// held is roughly how many bytes the values in variables take, counting
+	// only once there is a memory limit.
+	held int64
+}
+
+// DefaultDepth is the call depth limit when Limits doesn't set one. Each call
+// takes a few kilobytes of stack at most, so it stays well clear of the
+// default maximum stack size.
+const DefaultDepth = 10000
+
+func NewBudget(limits Limits) *Budget {
+	if limits.Depth <= 0 {
+		limits.Depth = DefaultDepth
+	}
+	b := &Budget{limits: limits, ctx: context.Background()}
+	if limits.Time > 0 {
+		b.deadline = time.Now().Add(limits.Time)
+	}
+	return b
+}
+
+// Steps returns how many steps have been taken so far.
+func (b *Budget) Steps() int64 { return b.steps }
+
+// Held returns roughly how many bytes the values in variables take, as far as
+// b has seen. It is only kept track of when there is a memory limit.
+func (b *Budget) Held() int64 { return b.held }
+
+// Hold counts n more bytes as held in variables, for values kept from runs
+// with other budgets.
+func (b *Budget) Hold(n int64) { b.held += n }
+
+// checkEvery is how many steps go by between checks of the clock and the
+// context.
+const checkEvery = 256
+
+func (b *Budget) step(t *ast.Token) error {
+	b.steps++
+	if b.limits.Steps > 0 && b.steps > b.limits.Steps {
+		return newLimitError(t, LimitSteps, nil,
+			"Step limit of %d exceeded", b.limits.Steps)
+	}
+	if b.steps%checkEvery == 0 {
+		return b.check(t)
+	}
+	return nil
+}
+
+func (b *Budget) check(t *ast.Token) error {
+	if !b.deadline.IsZero() && !time.Now().Before(b.deadline) {
+		return newLimitError(t, LimitTime, nil,
+			"Time limit of %v exceeded", b.limits.Time)
+	}
+	select {
+	case <-b.ctx.Done():
+		return newLimitError(t, LimitCanceled, b.ctx.Err(),
+			"Stopped: %v", b.ctx.Err())
+	default:
+	}
+	return nil
+}
+
+// enter records a call starting at t. Every successful enter must be
+// followed by a leave.
+func (b *Budget) enter(t *ast.Token) error {
+	if b.depth >= b.limits.Depth {
+		return newLimitError(t, LimitDepth, nil,
+			"Call depth limit of %d exceeded", b.limits.Depth)
+	}
+	b.depth++
+	return nil
+}
+
+func (b *Budget) leave() { b.depth-- }
+
+// reserve checks that a value of about size bytes may be made at t.
+func (b *Budget) reserve(t *ast.Token, size int64) error {
+	if b.limits.Memory > 0 && size > b.limits.Memory {
+		return newLimitError(t, LimitMemory, nil,
+			"Memory limit of %d bytes exceeded by a value of about %d bytes",
+			b.limits.Memory, size)
+	}
+	return nil
+}
+
+// hold records a variable that held old being set to new at t. It fails,
+// leaving the variable alone, if variables would then hold more than the
+// memory limit.
+func (b *Budget) hold(t *ast.Token, old, new Value) error {
+	if b.limits.Memory <= 0 {
+		return nil
+	}
+	return b.holdMore(t, old, new)
+}
+
+func (b *Budget) holdMore(t *ast.Token, old, new Value) error {
+	n := Size(new) - Size(old)
+	if n > 0 && b.held+n > b.limits.Memory {
+		return newLimitError(t, LimitMemory, nil,
+			"Memory limit of %d bytes exceeded, with about %d bytes held",
+			b.limits.Memory, b.held+n)
+	}
+	b.held += n
+	if b.held < 0 {
+		b.held = 0
+	}
+	return nil
+}
+
+// drop records that a variable holding v is gone.
+func (b *Budget) drop(v Value) {
+	if b.limits.Memory > 0 {
+		b.held -= Size(v)
+		if b.held < 0 {
+			b.held = 0
+		}
+	}
+}
+
+// Size returns roughly how many bytes v takes.
+func Size(v Value) int64 {
+	switch v := v.(type) {
+	case nil:
+		return 0
+	case ValString:
+		return 16 + int64(len(v.Val))
+	case ValNumber:
+		if v.rat == nil {
+			return 16
+		}
+		return 64 + int64(v.rat.Num().BitLen()+v.rat.Denom().BitLen())/8
+	default:
+		return 16
+	}
+}
+
+// RunContext is like RunAll, but stops with a *LimitError if ctx is done or
+// the code goes over the limits of b. b may be nil, for the default limits.
+func RunContext(ctx context.Context, s Scope, stmts []ast.Stmt,
+	b *Budget) error {
+	if b == nil {
+		b = NewBudget(Limits{})
+	}
+	defer func(ctx context.Context) { b.ctx = ctx }(b.ctx)
+	if !b.deadline.IsZero() {
+		// so builtins that block, like sleep, stop at the time limit too
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, b.deadline)
+		defer cancel()
+	}
+	b.ctx = ctx
+	c, err := compile(s, stmts)
+	if err != nil {
+		return err
+	}
+	_, err = c.exec(s, b)
+	return err
+}
+
+type Limit int
+
+const (
+	LimitSteps    Limit = iota + 1 // too many steps
+	LimitDepth                     // calls nested too deeply
+	LimitTime                      // ran for too long
+	LimitCanceled                  // the context was done
+	LimitMemory                    // values took too much memory
+)
+
+// LimitError is returned when running code is stopped for going over a limit
+// or because its context was done. It is reported like a runtime error.
+type LimitError struct {
+	Limit Limit
+	// Err is the context's error, for LimitCanceled.
+	Err error
+	re  *RuntimeError
+}
+
+func newLimitError(t *ast.Token, limit Limit, err error, format string,
+	args ...interface{}) *LimitError {
+	return &LimitError{
+		Limit: limit,
+		Err:   err,
+		re:    NewRuntimeError(t, format, args...),
+	}
+}
+
+func (e *LimitError) Error() string { return e.re.Error() }
+func (e *LimitError) Unwrap() error { return e.Err }
+
+func IsLimitError(err error) bool {
+	_, ok := err.(*LimitError)
+	return ok
+}
+
+func (l Limit) String() string {
+	switch l {
+	case LimitSteps:
+		return "steps"
+	case LimitDepth:
+		return "depth"
+	case LimitTime:
+		return "time"
+	case LimitCanceled:
+		return "canceled"
+	case LimitMemory:
+		return "memory"
+	default:
+		return fmt.Sprintf("Limit(%d)", int(l))
+	}
+}
@@ -0,0 +1,773 @@
+package interp
+
+import (
+	"fmt"
+
+	"github.com/jtolds/pants2/ast"
+)
+
+type opcode uint8
+
+const (
+	opStep          opcode = iota // count a step, at tokens[a]
+	opConst                       // push consts[a]
+	opNil                         // push nothing, for a variable without a value
+	opLoadSlot                    // push the value in slot a, read at tokens[b]
+	opLoadCaptured                // push the value in captured cell a
+	opLoadName                    // push the value of the variable named by tokens[a]
+	opCheckNew                    // fail if refs[a], named by tokens[b], is defined
+	opDefineSlot                  // pop a value into a new variable in slot a
+	opDefineName                  // pop a value into a new variable named by tokens[a]
+	opCheckSet                    // fail unless refs[a] is defined and writable
+	opStoreSlot                   // pop into slot a's variable, at tokens[b]
+	opStoreCaptured               // pop into captured cell a, at tokens[b]
+	opStoreName                   // pop a value into the variable named by tokens[a]
+	opNot                         // negate a truth value, at tokens[a]
+	opNeg                         // negate a number, at tokens[a]
+	opBinary                      // pop two values, push methods[a] of them
+	opArith                       // the same, for results that can outgrow them
+	opAnd                         // short-circuit to a unless the top is true
+	opOr                          // short-circuit to a unless the top is false
+	opMember                      // push member exprs[a] of the popped module
+	opIndex                       // fail, since indexing isn't supported
+	opCheckProc                   // fail unless the top is a procedure
+	opCallProc                    // call procedure calls[a] with b arguments
+	opCheckFunc                   // fail unless the top is a function
+	opCallFunc                    // call function calls[a] with b arguments
+	opTailCall                    // the same, as the value to return
+	opJump                        // continue at a
+	opIfFalse                     // pop a truth value and continue at a if false
+	opWhileFalse                  // the same, for while statements
+	opEnter                       // start block scope blocks[a]
+	opLeave                       // end the innermost block scope
+	opLeaveTo                     // end block scopes until a are left
+	opDefine                      // set up procedure or function defs[a]
+	opStmt                        // run stmts[a] directly
+	opReturn                      // pop a value and return it, at tokens[a]
+	opNoReturn                    // fail, at tokens[a], for falling off a function
+	opControl                     // leave with a control error, at tokens[a]
+)
+
+type instr struct {
+	op   opcode
+	a, b int32
+}
+
+type call struct {
+	token  *ast.Token
+	callee ast.Expr
+}
+
+type binaryOp func(t *ast.Token, left, right Value) (Value, error)
+
+type refKind uint8
+
+const (
+	refNone     refKind = iota // known not to be defined
+	refSlot                    // a slot in the running code's frame
+	refCaptured                // a cell captured when a procedure was defined
+	refName                    // looked up by name in the scope
+)
+
+// ref is where the compiler found a variable.
+type ref struct {
+	kind  refKind
+	index int
+}
+
+// blockInfo tells the VM which slots hold the variables declared in a block,
+// by name.
+type blockInfo struct {
+	names map[string]int
+	slots []int
+}
+
+// def is a procedure or function definition, with its compiled body.
+type def struct {
+	stmt ast.Stmt
+	name *ast.Token
+	body *code
+	dest ref
+}
+
+// code is a compiled list of statements, ready for exec.
+type code struct {
+	instrs  []instr
+	consts  []Value
+	tokens  []*ast.Token
+	refs    []ref
+	exprs   []ast.Expr
+	stmts   []ast.Stmt
+	calls   []call
+	methods []binaryOp
+	defs    []*def
+	blocks  []*blockInfo
+
+	// slots is how many slots a frame running the code needs. Procedure and
+	// function bodies keep their own variables in the slots of root, with
+	// their arguments in the params slots, and get the cells of the free
+	// names they use captured for them.
+	slots  int
+	root   *blockInfo
+	params []int
+	free   []string
+
+	// fn is set for function bodies, where return hands back a value
+	// instead of leaving with a control error.
+	fn bool
+	// ownCells is set for bodies that define no procedures or functions and
+	// run no statements directly, so nothing can hold on to the cells of
+	// their variables once they are done and frames can reuse them.
+	ownCells bool
+}
+
+type bindKind uint8
+
+const (
+	bindSlot    bindKind = iota // declared in the block, kept in a slot
+	bindName                    // kept by name, like imports and module variables
+	bindRemoved                 // undefined in the block
+)
+
+type binding struct {
+	kind bindKind
+	slot int
+}
+
+// scope is what the compiler knows about a block's variables at the point it
+// has compiled up to.
+type scope struct {
+	info     *blockInfo
+	bindings map[string]binding
+	// open is set once a whole module is imported into the block, which can
+	// bind names nothing else in the code mentions.
+	open bool
+	// imported holds the names bound by importing only some of a module's
+	// names, by module path, for unimport to forget.
+	imported map[string][]string
+}
+
+type loop struct {
+	depth  int
+	start  int
+	breaks []int
+}
+
+type compiler struct {
+	c *code
+	// parent is the compiler of the code a procedure or function is defined
+	// in, which is left at the definition while its body is compiled.
+	parent   *compiler
+	scopes   []*scope
+	captures map[string]int
+	loops    []*loop
+}
+
+// compile compiles statements to run at the top level of the scope s. Names
+// used without being defined anywhere are reported before any of it runs.
+func compile(s Scope, stmts []ast.Stmt) (*code, error) {
+	cc := newCompiler(s, &code{})
+	err := cc.block(stmts)
+	if err != nil {
+		return nil, err
+	}
+	return cc.c, nil
+}
+
+func compileExpr(s Scope, expr ast.Expr) (*code, error) {
+	cc := newCompiler(s, &code{fn: true})
+	err := cc.expr(expr)
+	if err != nil {
+		return nil, err
+	}
+	cc.emit(opReturn, 0, 0)
+	return cc.c, nil
+}
+
+func newCompiler(s Scope, c *code) *compiler {
+	module := &scope{bindings: map[string]binding{}}
+	for _, name := range s.Names() {
+		module.bindings[name] = binding{kind: bindName}
+	}
+	return &compiler{c: c, scopes: []*scope{module}}
+}
+
+// body compiles the body of a procedure or function defined at this point.
+func (cc *compiler) body(t *ast.Token, args []*ast.Var, stmts []ast.Stmt,
+	fn bool) (*code, error) {
+	body := &compiler{
+		c:        &code{fn: fn},
+		parent:   cc,
+		captures: map[string]int{},
+	}
+	body.c.root = body.push().info
+	for _, arg := range args {
+		body.c.params = append(body.c.params, body.declare(arg.Token.Val).index)
+	}
+	err := body.block(stmts)
+	if err != nil {
+		return nil, err
+	}
+	if fn {
+		body.emit(opNoReturn, body.token(t), 0)
+	}
+	body.c.ownCells = true
+	for _, in := range body.c.instrs {
+		if in.op == opDefine || in.op == opStmt {
+			body.c.ownCells = false
+		}
+	}
+	return body.c, nil
+}
+
+func (cc *compiler) emit(op opcode, a, b int) int {
+	cc.c.instrs = append(cc.c.instrs, instr{op: op, a: int32(a), b: int32(b)})
+	return len(cc.c.instrs) - 1
+}
+
+// here makes the jump at pc continue at the next instruction emitted.
+func (cc *compiler) here(pc int) {
+	cc.c.instrs[pc].a = int32(len(cc.c.instrs))
+}
+
+func (cc *compiler) token(t *ast.Token) int {
+	cc.c.tokens = append(cc.c.tokens, t)
+	return len(cc.c.tokens) - 1
+}
+
+func (cc *compiler) ref(r ref) int {
+	cc.c.refs = append(cc.c.refs, r)
+	return len(cc.c.refs) - 1
+}
+
+func (cc *compiler) constant(v Value) int {
+	cc.c.consts = append(cc.c.consts, v)
+	return len(cc.c.consts) - 1
+}
+
+func (cc *compiler) stmt(stmt ast.Stmt) int {
+	cc.c.stmts = append(cc.c.stmts, stmt)
+	return len(cc.c.stmts) - 1
+}
+
+func (cc *compiler) call(t *ast.Token, callee ast.Expr) int {
+	cc.c.calls = append(cc.c.calls, call{token: t, callee: callee})
+	return len(cc.c.calls) - 1
+}
+
+func (cc *compiler) push() *scope {
+	s := &scope{
+		info:     &blockInfo{names: map[string]int{}},
+		bindings: map[string]binding{},
+	}
+	cc.scopes = append(cc.scopes, s)
+	return s
+}
+
+func (cc *compiler) pop() {
+	cc.scopes = cc.scopes[:len(cc.scopes)-1]
+}
+
+func (cc *compiler) current() *scope {
+	return cc.scopes[len(cc.scopes)-1]
+}
+
+// topLevel says whether the compiler is at the top level of a module, where
+// variables are kept by name.
+func (cc *compiler) topLevel() bool {
+	return cc.parent == nil && len(cc.scopes) == 1
+}
+
+// declare makes a new variable in the current block, and says where it is.
+func (cc *compiler) declare(name string) ref {
+	s := cc.current()
+	if cc.topLevel() {
+		s.bindings[name] = binding{kind: bindName}
+		return ref{kind: refName}
+	}
+	slot, exists := s.info.names[name]
+	if !exists {
+		slot = cc.c.slots
+		cc.c.slots++
+		s.info.names[name] = slot
+		s.info.slots = append(s.info.slots, slot)
+	}
+	s.bindings[name] = binding{kind: bindSlot, slot: slot}
+	return ref{kind: refSlot, index: slot}
+}
+
+// find works out where the variable name refers to at this point, capturing
+// it from where the procedure is defined if it comes from there.
+func (cc *compiler) find(name string) ref {
+	open := false
+	for i := len(cc.scopes) - 1; i >= 0; i-- {
+		s := cc.scopes[i]
+		if b, exists := s.bindings[name]; exists {
+			if b.kind == bindSlot {
+				return ref{kind: refSlot, index: b.slot}
+			}
+			return ref{kind: refName}
+		}
+		open = open || s.open
+	}
+	if open {
+		return ref{kind: refName}
+	}
+	if cc.parent == nil || !cc.parent.known(name) {
+		return ref{kind: refNone}
+	}
+	slot, exists := cc.captures[name]
+	if !exists {
+		slot = len(cc.c.free)
+		cc.c.free = append(cc.c.free, name)
+		cc.captures[name] = slot
+	}
+	return ref{kind: refCaptured, index: slot}
+}
+
+// known says whether name might be defined at this point.
+func (cc *compiler) known(name string) bool {
+	for i := len(cc.scopes) - 1; i >= 0; i-- {
+		s := cc.scopes[i]
+		if _, exists := s.bindings[name]; exists || s.open {
+			return true
+		}
+	}
+	return cc.parent != nil && cc.parent.known(name)
+}
+
+// names lists the variables that might be defined at this point.
+func (cc *compiler) names() []string {
+	seen := map[string]bool{}
+	for c := cc; c != nil; c = c.parent {
+		for _, s := range c.scopes {
+			for name, b := range s.bindings {
+				if b.kind != bindRemoved {
+					seen[name] = true
+				}
+			}
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	return names
+}
+
+// resolve is find for a variable that is being used, which is an error if it
+// can't be defined.
+func (cc *compiler) resolve(t *ast.Token) (ref, error) {
+	r := cc.find(t.Val)
+	if r.kind == refNone {
+		return r, NewRuntimeError(t, "Variable %v not defined%s", t.Val,
+			didYouMean(t.Val, cc.names()))
+	}
+	return r, nil
+}
+
+func (cc *compiler) block(stmts []ast.Stmt) error {
+	for _, stmt := range stmts {
+		// loops count a step every time around instead
+		if _, ok := stmt.(*ast.StmtWhile); !ok {
+			cc.emit(opStep, cc.token(stmtToken(stmt)), 0)
+		}
+		err := cc.statement(stmt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scoped compiles stmts in a block scope of their own.
+func (cc *compiler) scoped(stmts []ast.Stmt) error {
+	if len(stmts) == 0 {
+		return nil
+	}
+	cc.enter()
+	err := cc.block(stmts)
+	cc.leave()
+	return err
+}
+
+func (cc *compiler) enter() {
+	cc.c.blocks = append(cc.c.blocks, cc.push().info)
+	cc.emit(opEnter, len(cc.c.blocks)-1, 0)
+}
+
+func (cc *compiler) leave() {
+	cc.pop()
+	cc.emit(opLeave, 0, 0)
+}
+
+// depth is how many block scopes the running code has entered.
+func (cc *compiler) depth() int {
+	return len(cc.scopes) - 1
+}
+
+// define compiles making a new variable named t, with the value on top of the
+// stack. It doesn't check whether the name is taken.
+func (cc *compiler) define(t *ast.Token) ref {
+	r := cc.declare(t.Val)
+	if r.kind == refSlot {
+		cc.emit(opDefineSlot, r.index, cc.token(t))
+	} else {
+		cc.emit(opDefineName, cc.token(t), 0)
+	}
+	return r
+}
+
+// checkNew compiles making sure the name t isn't taken yet.
+func (cc *compiler) checkNew(t *ast.Token) {
+	if r := cc.find(t.Val); r.kind != refNone {
+		cc.emit(opCheckNew, cc.ref(r), cc.token(t))
+	}
+}
+
+func (cc *compiler) statement(stmt ast.Stmt) error {
+	switch stmt := stmt.(type) {
+	case *ast.StmtVar:
+		for _, v := range stmt.Vars {
+			cc.checkNew(v.Token)
+		}
+		for _, v := range stmt.Vars {
+			if v.Expr != nil {
+				err := cc.expr(v.Expr)
+				if err != nil {
+					return err
+				}
+			} else {
+				cc.emit(opNil, 0, 0)
+			}
+			cc.define(v.Token)
+		}
+	case *ast.StmtAssignment:
+		r, err := cc.resolve(stmt.Lhs.Token)
+		if err != nil {
+			return err
+		}
+		t := cc.token(stmt.Lhs.Token)
+		cc.emit(opCheckSet, cc.ref(r), t)
+		err = cc.expr(stmt.Rhs)
+		if err != nil {
+			return err
+		}
+		switch r.kind {
+		case refSlot:
+			cc.emit(opStoreSlot, r.index, t)
+		case refCaptured:
+			cc.emit(opStoreCaptured, r.index, t)
+		default:
+			cc.emit(opStoreName, t, 0)
+		}
+	case *ast.StmtProcCall:
+		c := cc.call(stmt.Token, stmt.Proc)
+		err := cc.expr(stmt.Proc)
+		if err != nil {
+			return err
+		}
+		cc.emit(opCheckProc, c, 0)
+		err = cc.exprs(stmt.Args)
+		if err != nil {
+			return err
+		}
+		cc.emit(opCallProc, c, len(stmt.Args))
+	case *ast.StmtIf:
+		err := cc.expr(stmt.Test)
+		if err != nil {
+			return err
+		}
+		test := cc.emit(opIfFalse, 0, cc.token(stmt.Token))
+		err = cc.scoped(stmt.Body)
+		if err != nil {
+			return err
+		}
+		if len(stmt.Else) > 0 {
+			end := cc.emit(opJump, 0, 0)
+			cc.here(test)
+			err = cc.scoped(stmt.Else)
+			if err != nil {
+				return err
+			}
+			cc.here(end)
+		} else {
+			cc.here(test)
+		}
+	case *ast.StmtWhile:
+		// every time around the loop gets a fresh block scope, which the test
+		// is evaluated in too.
+		l := &loop{depth: cc.depth(), start: len(cc.c.instrs)}
+		cc.emit(opStep, cc.token(stmt.Token), 0)
+		cc.enter()
+		err := cc.expr(stmt.Test)
+		if err != nil {
+			return err
+		}
+		test := cc.emit(opWhileFalse, 0, cc.token(stmt.Token))
+		cc.loops = append(cc.loops, l)
+		err = cc.block(stmt.Body)
+		if err != nil {
+			return err
+		}
+		cc.loops = cc.loops[:len(cc.loops)-1]
+		cc.emit(opLeave, 0, 0)
+		cc.emit(opJump, l.start, 0)
+		cc.here(test)
+		cc.leave()
+		for _, pc := range l.breaks {
+			cc.here(pc)
+		}
+	case *ast.StmtControl:
+		if len(cc.loops) == 0 || stmt.Token.Val == string(CtrlDone) {
+			cc.emit(opControl, cc.token(stmt.Token), 0)
+			return nil
+		}
+		l := cc.loops[len(cc.loops)-1]
+		cc.emit(opLeaveTo, l.depth, 0)
+		switch ControlType(stmt.Token.Val) {
+		case CtrlBreak:
+			l.breaks = append(l.breaks, cc.emit(opJump, 0, 0))
+		case CtrlNext:
+			cc.emit(opJump, l.start, 0)
+		default:
+			panic(fmt.Sprintf("unknown control type: %s", stmt.Token.Val))
+		}
+	case *ast.StmtProcDef:
+		return cc.definition(stmt, stmt.Token, stmt.Name.Token, stmt.Args,
+			stmt.Body, false)
+	case *ast.StmtFuncDef:
+		return cc.definition(stmt, stmt.Token, stmt.Name.Token, stmt.Args,
+			stmt.Body, true)
+	case *ast.StmtReturn:
+		err := cc.expr(stmt.Val)
+		if err != nil {
+			return err
+		}
+		if _, ok := stmt.Val.(*ast.ExprFuncCall); ok && cc.c.fn {
+			cc.c.instrs[len(cc.c.instrs)-1].op = opTailCall
+		}
+		cc.emit(opReturn, cc.token(stmt.Token), 0)
+	case *ast.StmtUndefine:
+		cc.emit(opStmt, cc.stmt(stmt), 0)
+		for _, v := range stmt.Vars {
+			cc.current().bindings[v.Token.Val] = binding{kind: bindRemoved}
+		}
+	case *ast.StmtExport:
+		if cc.topLevel() {
+			for _, v := range stmt.Vars {
+				_, err := cc.resolve(v.Token)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		cc.emit(opStmt, cc.stmt(stmt), 0)
+	case *ast.StmtImport:
+		cc.emit(opStmt, cc.stmt(stmt), 0)
+		cc.imported(stmt)
+	case *ast.StmtUnimport:
+		cc.emit(opStmt, cc.stmt(stmt), 0)
+		s := cc.current()
+		for _, name := range s.imported[stmt.Path.Val] {
+			s.bindings[name] = binding{kind: bindRemoved}
+		}
+		delete(s.imported, stmt.Path.Val)
+	case *ast.StmtReload:
+		cc.emit(opStmt, cc.stmt(stmt), 0)
+	default:
+		panic(fmt.Sprintf("unsupported statement: %#v", stmt))
+	}
+	return nil
+}
+
+func (cc *compiler) definition(stmt ast.Stmt, t, name *ast.Token,
+	args []*ast.Var, stmts []ast.Stmt, fn bool) error {
+	cc.checkNew(name)
+	cc.emit(opNil, 0, 0)
+	// the name is defined before the body is compiled, so it can call
+	// itself
+	dest := cc.define(name)
+	body, err := cc.body(t, args, stmts, fn)
+	if err != nil {
+		return err
+	}
+	cc.c.defs = append(cc.c.defs, &def{
+		stmt: stmt,
+		name: name,
+		body: body,
+		dest: dest,
+	})
+	cc.emit(opDefine, len(cc.c.defs)-1, 0)
+	return nil
+}
+
+// imported notes the names an import statement binds in the current block.
+func (cc *compiler) imported(stmt *ast.StmtImport) {
+	s := cc.current()
+	var names []string
+	switch {
+	case stmt.As != nil:
+		names = append(names, stmt.As.Token.Val)
+	case stmt.Select != nil:
+		for _, in := range stmt.Names {
+			local := in.Name.Token
+			if in.Alias != nil {
+				local = in.Alias.Token
+			}
+			names = append(names, local.Val)
+		}
+	default:
+		s.open = true
+		return
+	}
+	if s.imported == nil {
+		s.imported = map[string][]string{}
+	}
+	for _, name := range names {
+		s.bindings[name] = binding{kind: bindName}
+		s.imported[stmt.Path.Val] = append(s.imported[stmt.Path.Val], name)
+	}
+}
+
+func (cc *compiler) exprs(exprs []ast.Expr) error {
+	for _, expr := range exprs {
+		err := cc.expr(expr)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cc *compiler) expr(expr ast.Expr) error {
+	switch expr := expr.(type) {
+	case *ast.ExprVar:
+		r, err := cc.resolve(expr.Token)
+		if err != nil {
+			return err
+		}
+		t := cc.token(expr.Token)
+		switch r.kind {
+		case refSlot:
+			cc.emit(opLoadSlot, r.index, t)
+		case refCaptured:
+			cc.emit(opLoadCaptured, r.index, t)
+		default:
+			cc.emit(opLoadName, t, 0)
+		}
+	case *ast.ExprString:
+		cc.emit(opConst, cc.constant(ValString{Val: expr.Val}), 0)
+	case *ast.ExprNumber:
+		cc.emit(opConst, cc.constant(NewNumber(&expr.Val)), 0)
+	case *ast.ExprBool:
+		cc.emit(opConst, cc.constant(ValBool{Val: expr.Val}), 0)
+	case *ast.ExprNot:
+		err := cc.expr(expr.Expr)
+		if err != nil {
+			return err
+		}
+		cc.emit(opNot, cc.token(expr.Token), 0)
+	case *ast.ExprNegative:
+		err := cc.expr(expr.Expr)
+		if err != nil {
+			return err
+		}
+		cc.emit(opNeg, cc.token(expr.Token), 0)
+	case *ast.ExprOp:
+		err := cc.expr(expr.Left)
+		if err != nil {
+			return err
+		}
+		switch expr.Op.Type {
+		case "and", "or":
+			op := opAnd
+			if expr.Op.Type == "or" {
+				op = opOr
+			}
+			skip := cc.emit(op, 0, cc.token(expr.Token))
+			err = cc.expr(expr.Right)
+			if err != nil {
+				return err
+			}
+			cc.here(skip)
+			return nil
+		}
+		err = cc.expr(expr.Right)
+		if err != nil {
+			return err
+		}
+		method, found := operations[expr.Op.Type]
+		if !found {
+			op := expr.Op.Type
+			method = func(t *ast.Token, left, right Value) (Value, error) {
+				return nil, unsupportedOp(t, op, left, right)
+			}
+		}
+		op := opBinary
+		if arithmetic[expr.Op.Type] {
+			op = opArith
+		}
+		cc.c.methods = append(cc.c.methods, method)
+		cc.emit(op, len(cc.c.methods)-1, cc.token(expr.Token))
+	case *ast.ExprIndex:
+		cc.emit(opIndex, cc.token(expr.Token), 0)
+	case *ast.ExprMember:
+		err := cc.expr(expr.Object)
+		if err != nil {
+			return err
+		}
+		cc.c.exprs = append(cc.c.exprs, expr)
+		cc.emit(opMember, len(cc.c.exprs)-1, 0)
+	case *ast.ExprFuncCall:
+		c := cc.call(expr.Token, expr.Func)
+		err := cc.expr(expr.Func)
+		if err != nil {
+			return err
+		}
+		cc.emit(opCheckFunc, c, 0)
+		err = cc.exprs(expr.Args)
+		if err != nil {
+			return err
+		}
+		cc.emit(opCallFunc, c, len(expr.Args))
+	default:
+		panic(fmt.Sprintf("unsupported expression: %#v", expr))
+	}
+	return nil
+}
+
+func stmtToken(stmt ast.Stmt) *ast.Token {
+	switch stmt := stmt.(type) {
+	case *ast.StmtIf:
+		return stmt.Token
+	case *ast.StmtVar:
+		return stmt.Token
+	case *ast.StmtAssignment:
+		return stmt.Token
+	case *ast.StmtWhile:
+		return stmt.Token
+	case *ast.StmtImport:
+		return stmt.Token
+	case *ast.StmtUnimport:
+		return stmt.Token
+	case *ast.StmtReload:
+		return stmt.Token
+	case *ast.StmtUndefine:
+		return stmt.Token
+	case *ast.StmtExport:
+		return stmt.Token
+	case *ast.StmtFuncDef:
+		return stmt.Token
+	case *ast.StmtProcDef:
+		return stmt.Token
+	case *ast.StmtProcCall:
+		return stmt.Token
+	case *ast.StmtControl:
+		return stmt.Token
+	case *ast.StmtReturn:
+		return stmt.Token
+	default:
+		panic(fmt.Sprintf("unsupported statement: %#v", stmt))
+	}
+}
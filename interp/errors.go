@@ -2,17 +2,108 @@ package interp
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/jtolds/pants2/ast"
 )
 
 func IsHandledError(err error) bool {
-	return ast.IsSyntaxError(err) || IsRuntimeError(err) || IsControlError(err)
+	return ast.IsSyntaxError(err) || IsRuntimeError(err) ||
+		IsControlError(err) || IsLimitError(err)
 }
 
 type RuntimeError struct {
 	token *ast.Token
 	msg   string
+	stack []callFrame
+}
+
+// callFrame is a call to a procedure or function that a runtime error passed
+// out of on its way up.
+type callFrame struct {
+	name string
+	call *ast.Token
+}
+
+// addFrame records that err, if it is a runtime error, passed out of a call
+// to name made at the call token.
+func addFrame(err error, name string, call *ast.Token) error {
+	if re := runtimeError(err); re != nil {
+		re.stack = append(re.stack, callFrame{name: name, call: call})
+	}
+	return err
+}
+
+// runtimeError returns the runtime error err is reported as, if any.
+func runtimeError(err error) *RuntimeError {
+	switch err := err.(type) {
+	case *RuntimeError:
+		return err
+	case *LimitError:
+		return err.re
+	default:
+		return nil
+	}
+}
+
+// repeatedFrames is how many times a recursive call, or a cycle of up to
+// maxCycle calls, is shown in a traceback before the rest of its repeats are
+// elided.
+const (
+	repeatedFrames = 3
+	maxCycle       = 4
+)
+
+// Traceback describes the procedure and function calls a runtime error
+// passed out of, most recent first, or returns "" if there weren't any.
+func Traceback(err error) string {
+	re := runtimeError(err)
+	if re == nil || len(re.stack) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("Called from, most recent call first:")
+	stack := re.stack
+	for len(stack) > 0 {
+		cycle, repeats := 1, 1
+		for n := 1; n <= maxCycle && n <= len(stack)/2; n++ {
+			if r := cycleRepeats(stack, n); r > repeats {
+				cycle, repeats = n, r
+			}
+		}
+		shown := repeats
+		if shown > repeatedFrames {
+			shown = repeatedFrames
+		}
+		for _, frame := range stack[:cycle*shown] {
+			fmt.Fprintf(&b, "\n  %s, called on file %#v, line %d: %s", frame.name,
+				frame.call.Line.Filename, frame.call.Line.Lineno,
+				strings.TrimSpace(frame.call.Line.Line))
+		}
+		if repeats > shown {
+			calls := "call"
+			if cycle > 1 {
+				calls = fmt.Sprintf("%d calls", cycle)
+			}
+			fmt.Fprintf(&b, "\n  ... the same %s repeated %d more times",
+				calls, repeats-shown)
+		}
+		stack = stack[cycle*repeats:]
+	}
+	return b.String()
+}
+
+// cycleRepeats counts how many times the first n frames of stack repeat in a
+// row at its start.
+func cycleRepeats(stack []callFrame, n int) (repeats int) {
+	for repeats = 1; (repeats+1)*n <= len(stack); repeats++ {
+		for i := 0; i < n; i++ {
+			if stack[repeats*n+i] != stack[i] {
+				return repeats
+			}
+		}
+	}
+	return repeats
 }
 
 func NewRuntimeError(token *ast.Token, format string, args ...interface{}) (
@@ -23,14 +114,26 @@ func NewRuntimeError(token *ast.Token, format string, args ...interface{}) (
 	}
 }
 
+// builtinError turns an error from a builtin procedure or function, which
+// doesn't know where it was called from, into a runtime error at the call,
+// naming what was called. Errors that already say where they happened are
+// returned as they are.
+func builtinError(call *ast.Token, callee ast.Expr, err error) error {
+	if err == nil || IsHandledError(err) {
+		return err
+	}
+	return NewRuntimeError(call, "%s: %v", callee, err)
+}
+
 func IsRuntimeError(err error) bool {
 	_, ok := err.(*RuntimeError)
 	return ok
 }
 
 func (e *RuntimeError) Error() string {
-	return fmt.Sprintf("Runtime error on file %#v, line %d: %s",
-		e.token.Line.Filename, e.token.Line.Lineno, e.msg)
+	return fmt.Sprintf("Runtime error on file %#v, line %d: %s%s",
+		e.token.Line.Filename, e.token.Line.Lineno, e.msg,
+		ast.Snippet(e.token.Line, e.token.Start, e.token.Length))
 }
 
 type ControlType string
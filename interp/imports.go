@@ -0,0 +1,135 @@
+package interp
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/jtolds/pants2/ast"
+)
+
+type ImportMode int
+
+const (
+	// ImportLive binds imported names to the exporting module's own cells, so
+	// changes made on either side are seen by both.
+	ImportLive ImportMode = iota
+	// ImportReadOnly is like ImportLive, but the importer may not assign to
+	// the imported names.
+	ImportReadOnly
+	// ImportSnapshot copies the exported values as they are at import time.
+	ImportSnapshot
+)
+
+func importMode(stmt *ast.StmtImport) ImportMode {
+	if stmt.Mode == nil {
+		return ImportLive
+	}
+	switch stmt.Mode.Val {
+	case "readonly":
+		return ImportReadOnly
+	case "snapshot":
+		return ImportSnapshot
+	default:
+		panic(fmt.Sprintf("unknown import mode: %s", stmt.Mode.Val))
+	}
+}
+
+// importBinding is a single exported name an import statement brings into
+// the importing scope.
+type importBinding struct {
+	name  string
+	local string
+	cell  *ValueCell
+}
+
+func (b importBinding) bind(mode ImportMode) *ValueCell {
+	if mode == ImportSnapshot {
+		return &ValueCell{
+			Def: b.cell.Def,
+			Val: b.cell.Val,
+		}
+	}
+	return b.cell
+}
+
+func (b importBinding) conflict(d *ValueCell) error {
+	if b.name == "" {
+		return fmt.Errorf(
+			"Module imported as %#v, but %#v already defined on file %#v, line %d",
+			b.local, b.local, d.Def.Filename, d.Def.Lineno)
+	}
+	if b.name != b.local {
+		return fmt.Errorf(
+			"Export defines %#v (imported as %#v), but %#v already defined on "+
+				"file %#v, line %d",
+			b.name, b.local, b.local, d.Def.Filename, d.Def.Lineno)
+	}
+	return fmt.Errorf(
+		"Export defines %#v, but %#v already defined on file %#v, line %d",
+		b.local, b.local, d.Def.Filename, d.Def.Lineno)
+}
+
+// importBindings works out which of a module's exported cells an import
+// statement binds, and to which names. IMPORT ... AS binds a single name, with
+// no exported name, to the module itself.
+func importBindings(stmt *ast.StmtImport, vals map[string]*ValueCell) (
+	[]importBinding, error) {
+	if stmt.As != nil {
+		mod := &ValModule{path: stmt.Path.Val, cells: vals}
+		if importMode(stmt) == ImportSnapshot {
+			mod.cells = make(map[string]*ValueCell, len(vals))
+			for name, cell := range vals {
+				mod.cells[name] = importBinding{cell: cell}.bind(ImportSnapshot)
+			}
+		}
+		return []importBinding{{
+			local: stmt.As.Token.Val,
+			cell:  &ValueCell{Def: stmt.Token.Line, Val: mod},
+		}}, nil
+	}
+	if stmt.Select == nil {
+		var prefix string
+		if stmt.Prefix != nil {
+			prefix = stmt.Prefix.Token.Val + "_"
+		}
+		names := make([]string, 0, len(vals))
+		for name := range vals {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		bindings := make([]importBinding, 0, len(names))
+		for _, name := range names {
+			bindings = append(bindings, importBinding{
+				name:  name,
+				local: prefix + name,
+				cell:  vals[name],
+			})
+		}
+		return bindings, nil
+	}
+
+	bindings := make([]importBinding, 0, len(stmt.Names))
+	locals := make(map[string]bool, len(stmt.Names))
+	for _, in := range stmt.Names {
+		name, local := in.Name.Token, in.Name.Token
+		if in.Alias != nil {
+			local = in.Alias.Token
+		}
+		cell, exists := vals[name.Val]
+		if !exists {
+			return nil, NewRuntimeError(name,
+				"Module %#v does not export %#v", stmt.Path.Val, name.Val)
+		}
+		if locals[local.Val] {
+			return nil, NewRuntimeError(local,
+				"%#v imported more than once", local.Val)
+		}
+		locals[local.Val] = true
+		bindings = append(bindings, importBinding{
+			name:  name.Val,
+			local: local.Val,
+			cell:  cell,
+		})
+	}
+	return bindings, nil
+}
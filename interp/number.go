@@ -0,0 +1,202 @@
+package interp
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/jtolds/pants2/lib/big"
+)
+
+// ValNumber is an exact rational number. Integers that fit in an int64 are
+// kept as one, so most arithmetic doesn't allocate, and everything else is
+// kept as a big.Rat.
+type ValNumber struct {
+	small int64
+	// rat is nil unless the number doesn't fit in small. It is never changed
+	// once it is set, so numbers can be copied freely.
+	rat *big.Rat
+}
+
+// NewNumber returns the number r. r is copied, so the caller can keep using
+// it.
+func NewNumber(r *big.Rat) ValNumber {
+	if n, ok := smallRat(r); ok {
+		return ValNumber{small: n}
+	}
+	return ValNumber{rat: new(big.Rat).Set(r)}
+}
+
+func NewInt(n int64) ValNumber { return ValNumber{small: n} }
+
+// boxedMin and boxedMax bound the integers kept ready in boxed, which covers
+// most of what loop counters and coordinates get up to.
+const (
+	boxedMin = -1024
+	boxedMax = 8191
+)
+
+// boxed holds small integers already turned into Values. Turning a ValNumber
+// into a Value otherwise allocates, and arithmetic does it for every result.
+var boxed = func() []Value {
+	rv := make([]Value, boxedMax-boxedMin+1)
+	for i := range rv {
+		rv[i] = ValNumber{small: int64(i + boxedMin)}
+	}
+	return rv
+}()
+
+// box returns v as a Value, without allocating if it is a small integer.
+func (v ValNumber) box() Value {
+	if v.rat == nil && boxedMin <= v.small && v.small <= boxedMax {
+		return boxed[v.small-boxedMin]
+	}
+	return v
+}
+
+func smallRat(r *big.Rat) (int64, bool) {
+	if !r.IsInt() || !r.Num().IsInt64() {
+		return 0, false
+	}
+	return r.Num().Int64(), true
+}
+
+// fromRat is like NewNumber, but takes ownership of r.
+func fromRat(r *big.Rat) ValNumber {
+	if n, ok := smallRat(r); ok {
+		return ValNumber{small: n}
+	}
+	return ValNumber{rat: r}
+}
+
+func (v ValNumber) big() *big.Rat {
+	if v.rat != nil {
+		return v.rat
+	}
+	return new(big.Rat).SetInt64(v.small)
+}
+
+// Rat returns the number as a big.Rat the caller is free to change.
+func (v ValNumber) Rat() *big.Rat {
+	if v.rat != nil {
+		return new(big.Rat).Set(v.rat)
+	}
+	return new(big.Rat).SetInt64(v.small)
+}
+
+// Int64 returns the number if it is an integer that fits in an int64.
+func (v ValNumber) Int64() (n int64, ok bool) {
+	return v.small, v.rat == nil
+}
+
+// Float64 returns the float64 nearest to the number, and whether that is
+// exactly the number.
+func (v ValNumber) Float64() (f float64, exact bool) {
+	if v.rat == nil && -1<<53 <= v.small && v.small <= 1<<53 {
+		return float64(v.small), true
+	}
+	return v.big().Float64()
+}
+
+func (v ValNumber) IsInt() bool { return v.rat == nil || v.rat.IsInt() }
+
+func (v ValNumber) Sign() int {
+	if v.rat != nil {
+		return v.rat.Sign()
+	}
+	switch {
+	case v.small < 0:
+		return -1
+	case v.small > 0:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func (v ValNumber) Cmp(w ValNumber) int {
+	if v.rat == nil && w.rat == nil {
+		switch {
+		case v.small < w.small:
+			return -1
+		case v.small > w.small:
+			return 1
+		default:
+			return 0
+		}
+	}
+	return v.big().Cmp(w.big())
+}
+
+func (v ValNumber) String() string {
+	if v.rat == nil {
+		return strconv.FormatInt(v.small, 10)
+	}
+	return strings.TrimRight(strings.TrimRight(v.rat.FloatString(10), "0"), ".")
+}
+
+func (v ValNumber) neg() ValNumber {
+	if v.rat == nil && v.small != math.MinInt64 {
+		return ValNumber{small: -v.small}
+	}
+	return fromRat(new(big.Rat).Neg(v.big()))
+}
+
+func (v ValNumber) add(w ValNumber) ValNumber {
+	if v.rat == nil && w.rat == nil {
+		if s := v.small + w.small; (s > v.small) == (w.small > 0) {
+			return ValNumber{small: s}
+		}
+	}
+	return fromRat(new(big.Rat).Add(v.big(), w.big()))
+}
+
+func (v ValNumber) sub(w ValNumber) ValNumber {
+	if v.rat == nil && w.rat == nil {
+		if s := v.small - w.small; (s < v.small) == (w.small > 0) {
+			return ValNumber{small: s}
+		}
+	}
+	return fromRat(new(big.Rat).Sub(v.big(), w.big()))
+}
+
+func (v ValNumber) mul(w ValNumber) ValNumber {
+	if v.rat == nil && w.rat == nil {
+		if w.small == 0 {
+			return ValNumber{}
+		}
+		p := v.small * w.small
+		if p/w.small == v.small && !(w.small == -1 && v.small == math.MinInt64) {
+			return ValNumber{small: p}
+		}
+	}
+	return fromRat(new(big.Rat).Mul(v.big(), w.big()))
+}
+
+// quo divides v by w, which must not be zero.
+func (v ValNumber) quo(w ValNumber) ValNumber {
+	if v.rat == nil && w.rat == nil && v.small%w.small == 0 &&
+		!(w.small == -1 && v.small == math.MinInt64) {
+		return ValNumber{small: v.small / w.small}
+	}
+	return fromRat(new(big.Rat).Quo(v.big(), w.big()))
+}
+
+// mod returns the Euclidean modulus of v and w, which must be integers, and w
+// must not be zero.
+func (v ValNumber) mod(w ValNumber) ValNumber {
+	if v.rat == nil && w.rat == nil {
+		m := v.small % w.small
+		if m < 0 {
+			if w.small < 0 {
+				m -= w.small
+			} else {
+				m += w.small
+			}
+		}
+		return ValNumber{small: m}
+	}
+	var m big.Int
+	m.Mod(v.big().Num(), w.big().Num())
+	return fromRat(new(big.Rat).SetInt(&m))
+}
@@ -4,7 +4,6 @@ import (
 	"fmt"
 
 	"github.com/jtolds/pants2/ast"
-	"github.com/jtolds/pants2/lib/big"
 )
 
 func equalityTest(left, right Value) bool {
@@ -13,8 +12,7 @@ func equalityTest(left, right Value) bool {
 	}
 	switch left.(type) {
 	case ValNumber:
-		x, y := left.(ValNumber).Val, right.(ValNumber).Val
-		return x.Cmp(&y) == 0
+		return left.(ValNumber).Cmp(right.(ValNumber)) == 0
 	case ValString:
 		return left.(ValString).Val == right.(ValString).Val
 	case ValBool:
@@ -53,8 +51,6 @@ func typename(val Value) typesym {
 	}
 }
 
-var zero big.Rat
-
 func unsupportedOp(t *ast.Token, op string, left, right Value) error {
 	return NewRuntimeError(t,
 		"unsupported operation: %s %s %s",
@@ -68,9 +64,7 @@ func Add(t *ast.Token, left, right Value) (v Value, err error) {
 		if !ok {
 			return nil, unsupportedOp(t, "+", left, right)
 		}
-		var rv ValNumber
-		rv.Val.Add(&x.Val, &y.Val)
-		return rv, nil
+		return x.add(y).box(), nil
 	case ValString:
 		y, ok := right.(ValString)
 		if !ok {
@@ -88,9 +82,7 @@ func Subtract(t *ast.Token, left, right Value) (v Value, err error) {
 	if !ok1 || !ok2 {
 		return nil, unsupportedOp(t, "-", left, right)
 	}
-	var rv ValNumber
-	rv.Val.Sub(&x.Val, &y.Val)
-	return rv, nil
+	return x.sub(y).box(), nil
 }
 
 func Multiply(t *ast.Token, left, right Value) (v Value, err error) {
@@ -99,9 +91,7 @@ func Multiply(t *ast.Token, left, right Value) (v Value, err error) {
 	if !ok1 || !ok2 {
 		return nil, unsupportedOp(t, "*", left, right)
 	}
-	var rv ValNumber
-	rv.Val.Mul(&x.Val, &y.Val)
-	return rv, nil
+	return x.mul(y).box(), nil
 }
 
 func Divide(t *ast.Token, left, right Value) (v Value, err error) {
@@ -110,14 +100,10 @@ func Divide(t *ast.Token, left, right Value) (v Value, err error) {
 	if !ok1 || !ok2 {
 		return nil, unsupportedOp(t, "/", left, right)
 	}
-	if zero.Cmp(&y.Val) == 0 {
+	if y.Sign() == 0 {
 		return nil, NewRuntimeError(t, "Division by zero")
 	}
-	var rv ValNumber
-	var im big.Rat
-	im.Inv(&y.Val)
-	rv.Val.Mul(&x.Val, &im)
-	return rv, nil
+	return x.quo(y).box(), nil
 }
 
 func Modulo(t *ast.Token, left, right Value) (v Value, err error) {
@@ -126,20 +112,13 @@ func Modulo(t *ast.Token, left, right Value) (v Value, err error) {
 	if !ok1 || !ok2 {
 		return nil, unsupportedOp(t, "%", left, right)
 	}
-	if zero.Cmp(&y.Val) == 0 {
+	if y.Sign() == 0 {
 		return nil, NewRuntimeError(t, "Division by zero")
 	}
-	leftdenom := x.Val.Denom()
-	rightdenom := y.Val.Denom()
-	if !leftdenom.IsInt64() || leftdenom.Int64() != 1 ||
-		!rightdenom.IsInt64() || rightdenom.Int64() != 1 {
+	if !x.IsInt() || !y.IsInt() {
 		return nil, NewRuntimeError(t, "Modulo only works on integers")
 	}
-	var rv ValNumber
-	var im big.Int
-	im.Mod(x.Val.Num(), y.Val.Num())
-	rv.Val.SetInt(&im)
-	return rv, nil
+	return x.mod(y).box(), nil
 }
 
 func LessThan(t *ast.Token, left, right Value) (v Value, err error) {
@@ -149,7 +128,7 @@ func LessThan(t *ast.Token, left, right Value) (v Value, err error) {
 		if !ok {
 			return nil, unsupportedOp(t, "<", left, right)
 		}
-		return ValBool{Val: x.Val.Cmp(&y.Val) < 0}, nil
+		return ValBool{Val: x.Cmp(y) < 0}, nil
 	case ValString:
 		y, ok := right.(ValString)
 		if !ok {
@@ -168,7 +147,7 @@ func LessThanEqual(t *ast.Token, left, right Value) (v Value, err error) {
 		if !ok {
 			return nil, unsupportedOp(t, "<=", left, right)
 		}
-		return ValBool{Val: x.Val.Cmp(&y.Val) <= 0}, nil
+		return ValBool{Val: x.Cmp(y) <= 0}, nil
 	case ValString:
 		y, ok := right.(ValString)
 		if !ok {
@@ -187,7 +166,7 @@ func GreaterThan(t *ast.Token, left, right Value) (v Value, err error) {
 		if !ok {
 			return nil, unsupportedOp(t, ">", left, right)
 		}
-		return ValBool{Val: x.Val.Cmp(&y.Val) > 0}, nil
+		return ValBool{Val: x.Cmp(y) > 0}, nil
 	case ValString:
 		y, ok := right.(ValString)
 		if !ok {
@@ -206,7 +185,7 @@ func GreaterThanEqual(t *ast.Token, left, right Value) (v Value, err error) {
 		if !ok {
 			return nil, unsupportedOp(t, ">=", left, right)
 		}
-		return ValBool{Val: x.Val.Cmp(&y.Val) >= 0}, nil
+		return ValBool{Val: x.Cmp(y) >= 0}, nil
 	case ValString:
 		y, ok := right.(ValString)
 		if !ok {
@@ -239,3 +218,9 @@ var operations = map[string]func(t *ast.Token, left, right ast.Value) (ast.Value
 	"==": Equal,
 	"!=": NotEqual,
 }
+
+// arithmetic holds the operations whose result can take more memory than
+// their operands, though never more than both of them together.
+var arithmetic = map[string]bool{
+	"+": true, "-": true, "*": true, "/": true, "%": true,
+}
@@ -0,0 +1,206 @@
+package interp
+
+import (
+	"github.com/jtolds/pants2/ast"
+)
+
+// Optimize returns stmts with constant expressions folded into literals and
+// code that can never run dropped. Folded literals keep the token of the
+// expression they replace, so errors still point at the same source. stmts
+// itself is left unchanged.
+func Optimize(stmts []ast.Stmt) []ast.Stmt {
+	rv := make([]ast.Stmt, 0, len(stmts))
+	for _, stmt := range stmts {
+		if stmt = optimizeStmt(stmt); stmt != nil {
+			rv = append(rv, stmt)
+		}
+	}
+	return rv
+}
+
+// optimizeStmt returns the optimized stmt, or nil if it does nothing.
+func optimizeStmt(stmt ast.Stmt) ast.Stmt {
+	switch stmt := stmt.(type) {
+	case *ast.StmtIf:
+		test := fold(stmt.Test)
+		if b, ok := test.(*ast.ExprBool); ok {
+			body := stmt.Body
+			if !b.Val {
+				if len(stmt.Else) == 0 {
+					return nil
+				}
+				test = &ast.ExprBool{Token: b.Token, Val: true}
+				body = stmt.Else
+			}
+			// the body still gets its own block scope
+			return &ast.StmtIf{Token: stmt.Token, Test: test, Body: Optimize(body)}
+		}
+		return &ast.StmtIf{
+			Token: stmt.Token,
+			Test:  test,
+			Body:  Optimize(stmt.Body),
+			Else:  Optimize(stmt.Else)}
+	case *ast.StmtWhile:
+		test := fold(stmt.Test)
+		b, ok := test.(*ast.ExprBool)
+		if ok && !b.Val {
+			return nil
+		}
+		body := Optimize(stmt.Body)
+		if ok && runsOnce(body) {
+			// loop { ... break } is just a block
+			return &ast.StmtIf{Token: stmt.Token, Test: test,
+				Body: body[:len(body)-1]}
+		}
+		return &ast.StmtWhile{Token: stmt.Token, Test: test, Body: body}
+	case *ast.StmtVar:
+		vars := make([]*ast.Var, 0, len(stmt.Vars))
+		for _, v := range stmt.Vars {
+			if v.Expr != nil {
+				v = &ast.Var{Token: v.Token, Expr: fold(v.Expr)}
+			}
+			vars = append(vars, v)
+		}
+		return &ast.StmtVar{Token: stmt.Token, Vars: vars}
+	case *ast.StmtAssignment:
+		return &ast.StmtAssignment{Token: stmt.Token, Lhs: stmt.Lhs,
+			Rhs: fold(stmt.Rhs)}
+	case *ast.StmtProcCall:
+		return &ast.StmtProcCall{Token: stmt.Token, Proc: fold(stmt.Proc),
+			Args: foldAll(stmt.Args)}
+	case *ast.StmtReturn:
+		return &ast.StmtReturn{Token: stmt.Token, Val: fold(stmt.Val)}
+	case *ast.StmtFuncDef:
+		return &ast.StmtFuncDef{Token: stmt.Token, Name: stmt.Name,
+			Args: stmt.Args, Body: Optimize(stmt.Body)}
+	case *ast.StmtProcDef:
+		return &ast.StmtProcDef{Token: stmt.Token, Name: stmt.Name,
+			Args: stmt.Args, Body: Optimize(stmt.Body)}
+	default:
+		return stmt
+	}
+}
+
+// runsOnce says whether a loop with the given body always stops at the end
+// of its first time around: it ends with a break and has no other break or
+// next for the loop.
+func runsOnce(body []ast.Stmt) bool {
+	if len(body) == 0 {
+		return false
+	}
+	last, ok := body[len(body)-1].(*ast.StmtControl)
+	if !ok || last.Token.Val != string(CtrlBreak) {
+		return false
+	}
+	return !continues(body[:len(body)-1])
+}
+
+// continues says whether stmts break out of or go around the loop they are
+// in anywhere.
+func continues(stmts []ast.Stmt) bool {
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *ast.StmtControl:
+			if stmt.Token.Val != string(CtrlDone) {
+				return true
+			}
+		case *ast.StmtIf:
+			if continues(stmt.Body) || continues(stmt.Else) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func foldAll(exprs []ast.Expr) []ast.Expr {
+	rv := make([]ast.Expr, 0, len(exprs))
+	for _, expr := range exprs {
+		rv = append(rv, fold(expr))
+	}
+	return rv
+}
+
+// fold returns expr with its constant parts worked out. Anything that would
+// fail is left for when it runs, so it fails then, if it ever does.
+func fold(expr ast.Expr) ast.Expr {
+	switch expr := expr.(type) {
+	case *ast.ExprOp:
+		left, right := fold(expr.Left), fold(expr.Right)
+		switch expr.Op.Type {
+		case "and", "or":
+			// the right side is only worked out if the left side doesn't
+			// decide the answer
+			if b, ok := left.(*ast.ExprBool); ok {
+				if b.Val == (expr.Op.Type == "or") {
+					return left
+				}
+				return right
+			}
+		default:
+			x, ok1 := constant(left)
+			y, ok2 := constant(right)
+			if ok1 && ok2 {
+				v, err := operations[expr.Op.Type](expr.Token, x, y)
+				if err == nil {
+					return literal(expr.Token, v)
+				}
+			}
+		}
+		return &ast.ExprOp{Token: expr.Token, Left: left, Op: expr.Op,
+			Right: right}
+	case *ast.ExprNot:
+		val := fold(expr.Expr)
+		if b, ok := val.(*ast.ExprBool); ok {
+			return &ast.ExprBool{Token: expr.Token, Val: !b.Val}
+		}
+		return &ast.ExprNot{Token: expr.Token, Expr: val}
+	case *ast.ExprNegative:
+		val := fold(expr.Expr)
+		if n, ok := val.(*ast.ExprNumber); ok {
+			rv := &ast.ExprNumber{Token: expr.Token}
+			rv.Val.Neg(&n.Val)
+			return rv
+		}
+		return &ast.ExprNegative{Token: expr.Token, Expr: val}
+	case *ast.ExprFuncCall:
+		return &ast.ExprFuncCall{Token: expr.Token, Func: fold(expr.Func),
+			Args: foldAll(expr.Args)}
+	case *ast.ExprMember:
+		return &ast.ExprMember{Token: expr.Token, Object: fold(expr.Object),
+			Member: expr.Member}
+	case *ast.ExprIndex:
+		return &ast.ExprIndex{Token: expr.Token, Object: fold(expr.Object),
+			Index: fold(expr.Index)}
+	default:
+		return expr
+	}
+}
+
+// constant returns the value of a number or string literal. Truth values
+// are left alone, as operations on them aren't supported.
+func constant(expr ast.Expr) (Value, bool) {
+	switch expr := expr.(type) {
+	case *ast.ExprNumber:
+		return NewNumber(&expr.Val), true
+	case *ast.ExprString:
+		return ValString{Val: expr.Val}, true
+	default:
+		return nil, false
+	}
+}
+
+func literal(t *ast.Token, v Value) ast.Expr {
+	switch v := v.(type) {
+	case ValNumber:
+		rv := &ast.ExprNumber{Token: t}
+		rv.Val.Set(v.Rat())
+		return rv
+	case ValString:
+		return &ast.ExprString{Token: t, Val: v.Val}
+	case ValBool:
+		return &ast.ExprBool{Token: t, Val: v.Val}
+	default:
+		panic("unexpected constant")
+	}
+}
@@ -0,0 +1,200 @@
+package interp
+
+import (
+	"fmt"
+
+	"github.com/jtolds/pants2/ast"
+)
+
+// ModuleReloader is implemented by ModuleImporters that can load a module
+// again after its source has changed.
+type ModuleReloader interface {
+	// Reload re-executes the module named by path, which must already have
+	// been imported. from is the line containing the reload statement.
+	Reload(from *ast.Line, path string) error
+}
+
+func reload(importer ModuleImporter, stmt *ast.StmtReload) error {
+	r, ok := importer.(ModuleReloader)
+	if !ok {
+		return fmt.Errorf("Modules can't be reloaded here")
+	}
+	return r.Reload(stmt.Token.Line, stmt.Path.Val)
+}
+
+// ReuseCells makes the next definition of each of the given names at this
+// scope's top level store its value in the existing cell instead of a new
+// one. Reloading a module reuses its old exported cells this way, so anything
+// still holding on to them, such as live imports or procedures that captured
+// them, sees the module's new values.
+func (s *FlatScope) ReuseCells(cells map[string]*ValueCell) {
+	s.reuse = make(map[string]*ValueCell, len(cells))
+	for name, cell := range cells {
+		s.reuse[name] = cell
+	}
+}
+
+// Reimport brings this scope's imports of a reloaded module up to date with
+// its new exports. reloaded says whether an import statement refers to the
+// reloaded module. Names the module no longer exports are unbound, and new
+// ones are bound unless that would clobber one of this scope's own variables.
+func (s *FlatScope) Reimport(reloaded func(*ast.StmtImport) bool,
+	vals map[string]*ValueCell) {
+	for path, stmts := range s.imports {
+		if !reloaded(stmts[0]) {
+			continue
+		}
+		unimports := s.unimports[path]
+		bound := map[string]bool{}
+		for _, r := range rebindings(stmts, vals) {
+			if _, exists := s.vars[r.local]; exists && !unimports[r.local] {
+				continue
+			}
+			s.vars[r.local] = r.cell
+			if r.readonly {
+				s.readonly[r.local] = true
+			}
+			unimports[r.local] = true
+			bound[r.local] = true
+		}
+		for local := range unimports {
+			if !bound[local] {
+				delete(s.vars, local)
+				delete(s.readonly, local)
+				delete(unimports, local)
+			}
+		}
+	}
+}
+
+// ReimportBlocks does what Reimport does for the imports of the blocks
+// running under this scope or any scope flattened from it.
+func (s *FlatScope) ReimportBlocks(reloaded func(*ast.StmtImport) bool,
+	vals map[string]*ValueCell) {
+	for f := range s.blocks {
+		f.reimport(reloaded, vals)
+	}
+}
+
+func (f *ForkScope) reimport(reloaded func(*ast.StmtImport) bool,
+	vals map[string]*ValueCell) {
+	for path, stmts := range f.imports {
+		if !reloaded(stmts[0]) {
+			continue
+		}
+		unimports := f.unimports[path]
+		bound := map[string]bool{}
+		for _, r := range rebindings(stmts, vals) {
+			if f.Lookup(r.local) != nil && !unimports[r.local] {
+				continue
+			}
+			f.Define(r.local, r.cell)
+			if r.readonly {
+				if f.readonly == nil {
+					f.readonly = map[string]bool{}
+				}
+				f.readonly[r.local] = true
+			}
+			unimports[r.local] = true
+			bound[r.local] = true
+		}
+		for local := range unimports {
+			if !bound[local] {
+				delete(f.vars, local)
+				delete(f.readonly, local)
+				delete(unimports, local)
+			}
+		}
+	}
+}
+
+// rebinding is a name an import of a reloaded module binds.
+type rebinding struct {
+	local    string
+	cell     *ValueCell
+	readonly bool
+}
+
+// rebindings works out the names stmts, the imports of one module, bind now
+// that the module exports vals.
+func rebindings(stmts []*ast.StmtImport,
+	vals map[string]*ValueCell) []rebinding {
+	var rv []rebinding
+	for _, stmt := range stmts {
+		bindings, err := importBindings(stillExported(stmt, vals), vals)
+		if err != nil {
+			continue
+		}
+		mode := importMode(stmt)
+		for _, b := range bindings {
+			rv = append(rv, rebinding{
+				local:    b.local,
+				cell:     b.bind(mode),
+				readonly: mode == ImportReadOnly})
+		}
+	}
+	return rv
+}
+
+// stillExported returns stmt with any selected names the module no longer
+// exports left out.
+func stillExported(stmt *ast.StmtImport, vals map[string]*ValueCell) *ast.StmtImport {
+	if stmt.Select == nil {
+		return stmt
+	}
+	c := *stmt
+	c.Names = nil
+	for _, in := range stmt.Names {
+		if _, exists := vals[in.Name.Token.Val]; exists {
+			c.Names = append(c.Names, in)
+		}
+	}
+	return &c
+}
+
+// Unchanged reports whether a reloaded module's new value for a name is the
+// same as its old one: equal numbers, strings or truth values, or procedures
+// and functions with identical definitions.
+func Unchanged(old, new Value) bool {
+	if old == nil || new == nil {
+		return old == nil && new == nil
+	}
+	switch o := old.(type) {
+	case ValNumber:
+		n, ok := new.(ValNumber)
+		return ok && o.Cmp(n) == 0
+	case ValString:
+		n, ok := new.(ValString)
+		return ok && o.Val == n.Val
+	case ValBool:
+		n, ok := new.(ValBool)
+		return ok && o.Val == n.Val
+	case *UserProc:
+		n, ok := new.(*UserProc)
+		return ok && o.definition() == n.definition()
+	case *UserFunc:
+		n, ok := new.(*UserFunc)
+		return ok && o.definition() == n.definition()
+	case *ValModule:
+		n, ok := new.(*ValModule)
+		return ok && o.path == n.path
+	default:
+		return false
+	}
+}
+
+func (p *UserProc) definition() string {
+	return (&ast.StmtProcDef{
+		Name: &ast.Var{Token: &ast.Token{Val: p.name}},
+		Args: p.args,
+		Body: p.body,
+	}).String()
+}
+
+func (f *UserFunc) definition() string {
+	return (&ast.StmtFuncDef{
+		Name: &ast.Var{Token: &ast.Token{Val: f.name}},
+		Args: f.args,
+		Body: f.body,
+	}).String()
+}
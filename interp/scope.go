@@ -6,35 +6,57 @@ import (
 	"github.com/jtolds/pants2/ast"
 )
 
-type ModuleImporterFunc func(path string) (map[string]*ValueCell, error)
+type ModuleImporterFunc func(from *ast.Line, path string) (
+	map[string]*ValueCell, error)
 
-func (f ModuleImporterFunc) Import(path string) (map[string]*ValueCell, error) {
-	return f(path)
+func (f ModuleImporterFunc) Import(from *ast.Line, path string) (
+	map[string]*ValueCell, error) {
+	return f(from, path)
 }
 
 type ModuleImporter interface {
-	Import(path string) (map[string]*ValueCell, error)
+	// Import loads the module named by path. from is the line containing the
+	// import statement, so relative paths can be resolved against it.
+	Import(from *ast.Line, path string) (map[string]*ValueCell, error)
 }
 
 type Scope interface {
 	Flatten() Scope
 	Fork() Scope
 
-	Lookup(name string) (vc *ValueCell, depth int)
-	LookupDepth(name string, depth int) *ValueCell
+	Lookup(name string) *ValueCell
 	Define(name string, v *ValueCell)
 	Remove(name string)
+	ReadOnly(name string) bool
 	Export(stmt *ast.StmtExport) error
-	Import(path, prefix string) error
+	Import(stmt *ast.StmtImport) error
 	Unimport(path string) error
+	Reload(stmt *ast.StmtReload) error
 	Exports() map[string]*ValueCell
+	// Names returns every name defined in the scope.
+	Names() []string
 }
 
+// ForkScope is a block scope. Variables the compiler gave slots to live in
+// the slots of the frame running the block, and names maps them to their
+// slot. Anything else, like block imports, goes in vars.
 type ForkScope struct {
-	parent Scope
-	vars   map[string]*ValueCell
+	parent    Scope
+	vars      map[string]*ValueCell
+	names     map[string]int
+	slots     []*ValueCell
+	unimports map[string]map[string]bool
+	readonly  map[string]bool
+	imports   map[string][]*ast.StmtImport
+	// blocks is the registry this block is in while it has imports, so they
+	// can be rebound when the modules are reloaded.
+	blocks blockScopes
 }
 
+// blockScopes is the set of block scopes with imports under a top-level
+// scope and every scope flattened from it.
+type blockScopes map[*ForkScope]bool
+
 func NewForkScope(parent Scope) *ForkScope {
 	var sf ForkScope
 	sf.Init(parent)
@@ -42,29 +64,63 @@ func NewForkScope(parent Scope) *ForkScope {
 }
 
 func (f *ForkScope) Init(parent Scope) {
+	f.init(parent, nil, nil)
+}
+
+func (f *ForkScope) init(parent Scope, names map[string]int,
+	slots []*ValueCell) {
+	f.forget()
 	f.parent = parent
+	f.names = names
+	f.slots = slots
 	if f.vars != nil {
 		for k := range f.vars {
 			delete(f.vars, k)
 		}
 	}
+	if f.unimports != nil {
+		for k := range f.unimports {
+			delete(f.unimports, k)
+		}
+	}
+	if f.readonly != nil {
+		for k := range f.readonly {
+			delete(f.readonly, k)
+		}
+	}
+	if f.imports != nil {
+		for k := range f.imports {
+			delete(f.imports, k)
+		}
+	}
 }
 
-func (f *ForkScope) Lookup(name string) (vc *ValueCell, depth int) {
+// forget takes the block out of its registry, once it is done running.
+func (f *ForkScope) forget() {
+	if f.blocks != nil {
+		delete(f.blocks, f)
+		f.blocks = nil
+	}
+}
+
+// slot returns the cell in the slot for name, if name has a slot here.
+func (f *ForkScope) slot(name string) (vc *ValueCell, ok bool) {
+	if i, exists := f.names[name]; exists {
+		return f.slots[i], true
+	}
+	return nil, false
+}
+
+func (f *ForkScope) Lookup(name string) *ValueCell {
 	if f.vars != nil {
 		if vc, exists := f.vars[name]; exists {
-			return vc, 0
+			return vc
 		}
 	}
-	vc, depth = f.parent.Lookup(name)
-	return vc, depth + 1
-}
-
-func (f *ForkScope) LookupDepth(name string, depth int) (vc *ValueCell) {
-	if depth > 0 {
-		return f.parent.LookupDepth(name, depth-1)
+	if vc, _ := f.slot(name); vc != nil {
+		return vc
 	}
-	return f.vars[name]
+	return f.parent.Lookup(name)
 }
 
 func (f *ForkScope) Define(name string, v *ValueCell) {
@@ -72,6 +128,20 @@ func (f *ForkScope) Define(name string, v *ValueCell) {
 		f.vars = map[string]*ValueCell{}
 	}
 	f.vars[name] = v
+	if f.readonly != nil {
+		delete(f.readonly, name)
+	}
+}
+
+// setSlot defines the variable name kept in slot i.
+func (f *ForkScope) setSlot(i int, name string, v *ValueCell) {
+	f.slots[i] = v
+	if len(f.vars) > 0 {
+		delete(f.vars, name)
+	}
+	if len(f.readonly) > 0 {
+		delete(f.readonly, name)
+	}
 }
 
 func (f *ForkScope) Export(stmt *ast.StmtExport) error {
@@ -84,6 +154,11 @@ func (f *ForkScope) Exports() map[string]*ValueCell {
 
 func (f *ForkScope) Flatten() Scope {
 	s := f.parent.Flatten()
+	for k, i := range f.names {
+		if f.slots[i] != nil {
+			s.Define(k, f.slots[i])
+		}
+	}
 	for k, v := range f.vars {
 		if v != nil {
 			s.Define(k, v)
@@ -91,23 +166,142 @@ func (f *ForkScope) Flatten() Scope {
 			s.Remove(k)
 		}
 	}
+	if flat, ok := s.(*FlatScope); ok {
+		for k := range f.readonly {
+			flat.readonly[k] = true
+		}
+	}
 	return s
 }
 
+func (f *ForkScope) Names() []string {
+	names := map[string]bool{}
+	for _, name := range f.parent.Names() {
+		names[name] = true
+	}
+	for name, i := range f.names {
+		if f.slots[i] != nil {
+			names[name] = true
+		}
+	}
+	for name, v := range f.vars {
+		names[name] = v != nil
+	}
+	rv := make([]string, 0, len(names))
+	for name, defined := range names {
+		if defined {
+			rv = append(rv, name)
+		}
+	}
+	return rv
+}
+
 func (f *ForkScope) Fork() Scope {
 	return NewForkScope(f)
 }
 
-func (f *ForkScope) Import(path, prefix string) error {
-	return fmt.Errorf("TODO: import unsupported on forked scope")
+func (f *ForkScope) ReadOnly(name string) bool {
+	if f.vars != nil {
+		if _, exists := f.vars[name]; exists {
+			return f.readonly[name]
+		}
+	}
+	if vc, _ := f.slot(name); vc != nil {
+		return false
+	}
+	return f.parent.ReadOnly(name)
+}
+
+// flat finds the module scope this fork ultimately belongs to.
+func (f *ForkScope) flat() *FlatScope {
+	switch parent := f.parent.(type) {
+	case *ForkScope:
+		return parent.flat()
+	case *FlatScope:
+		return parent
+	default:
+		panic(fmt.Sprintf("unknown scope type: %T", parent))
+	}
+}
+
+func (f *ForkScope) importer() ModuleImporter {
+	return f.flat().importer
+}
+
+// Import binds a module's names in this block only. They go away with the
+// block when it is done running.
+func (f *ForkScope) Import(stmt *ast.StmtImport) error {
+	path := stmt.Path.Val
+	if _, exists := f.unimports[path]; exists &&
+		stmt.Select == nil && stmt.As == nil {
+		return fmt.Errorf("%#v already imported", path)
+	}
+	vals, err := f.importer().Import(stmt.Token.Line, path)
+	if err != nil {
+		return err
+	}
+	bindings, err := importBindings(stmt, vals)
+	if err != nil {
+		return err
+	}
+	for _, b := range bindings {
+		if d := f.Lookup(b.local); d != nil {
+			return b.conflict(d)
+		}
+	}
+	mode := importMode(stmt)
+	if f.unimports == nil {
+		f.unimports = map[string]map[string]bool{}
+	}
+	unimports := f.unimports[path]
+	if unimports == nil {
+		unimports = make(map[string]bool, len(bindings))
+	}
+	for _, b := range bindings {
+		f.Define(b.local, b.bind(mode))
+		if mode == ImportReadOnly {
+			if f.readonly == nil {
+				f.readonly = map[string]bool{}
+			}
+			f.readonly[b.local] = true
+		}
+		unimports[b.local] = true
+	}
+	f.unimports[path] = unimports
+	if f.imports == nil {
+		f.imports = map[string][]*ast.StmtImport{}
+	}
+	f.imports[path] = append(f.imports[path], stmt)
+	if f.blocks == nil {
+		f.blocks = f.flat().blocks
+		f.blocks[f] = true
+	}
+	return nil
 }
 
 func (f *ForkScope) Unimport(path string) error {
-	return fmt.Errorf("TODO: unimport unsupported on forked scope")
+	vars, exists := f.unimports[path]
+	if !exists {
+		return fmt.Errorf("Module %#v not imported in this block", path)
+	}
+	for v := range vars {
+		delete(f.vars, v)
+		delete(f.readonly, v)
+	}
+	delete(f.unimports, path)
+	delete(f.imports, path)
+	return nil
+}
+
+func (f *ForkScope) Reload(stmt *ast.StmtReload) error {
+	return reload(f.importer(), stmt)
 }
 
 func (f *ForkScope) Remove(name string) {
 	f.Define(name, nil)
+	for mod := range f.unimports {
+		delete(f.unimports[mod], name)
+	}
 }
 
 type FlatScope struct {
@@ -115,6 +309,10 @@ type FlatScope struct {
 	exports   map[string]*ValueCell
 	importer  ModuleImporter
 	unimports map[string]map[string]bool
+	readonly  map[string]bool
+	imports   map[string][]*ast.StmtImport
+	reuse     map[string]*ValueCell
+	blocks    blockScopes
 }
 
 func NewFlatScope(importer ModuleImporter) *FlatScope {
@@ -122,28 +320,56 @@ func NewFlatScope(importer ModuleImporter) *FlatScope {
 		vars:      map[string]*ValueCell{},
 		importer:  importer,
 		unimports: map[string]map[string]bool{},
+		readonly:  map[string]bool{},
+		imports:   map[string][]*ast.StmtImport{},
+		blocks:    blockScopes{},
 	}
 }
 
-func (s *FlatScope) Lookup(name string) (*ValueCell, int) {
-	return s.vars[name], 0
-}
-
-func (s *FlatScope) LookupDepth(name string, depth int) *ValueCell {
+func (s *FlatScope) Lookup(name string) *ValueCell {
 	return s.vars[name]
 }
 
 func (s *FlatScope) Define(name string, v *ValueCell) {
+	if cell := s.reuse[name]; cell != nil && v != nil {
+		*cell = *v
+		v = cell
+		delete(s.reuse, name)
+	}
 	s.vars[name] = v
+	delete(s.readonly, name)
 }
 
 func (s *FlatScope) Remove(name string) {
 	delete(s.vars, name)
+	delete(s.readonly, name)
 	for mod := range s.unimports {
 		delete(s.unimports[mod], name)
 	}
 }
 
+// imported reports whether name was bound by an import.
+func (s *FlatScope) imported(name string) bool {
+	for _, names := range s.unimports {
+		if names[name] {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *FlatScope) Names() []string {
+	rv := make([]string, 0, len(s.vars))
+	for name := range s.vars {
+		rv = append(rv, name)
+	}
+	return rv
+}
+
+func (s *FlatScope) ReadOnly(name string) bool {
+	return s.readonly[name]
+}
+
 func (s *FlatScope) Export(stmt *ast.StmtExport) error {
 	if s.exports == nil {
 		return NewRuntimeError(stmt.Token, "Unexpected export")
@@ -156,10 +382,9 @@ func (s *FlatScope) Export(stmt *ast.StmtExport) error {
 		}
 	}
 	for _, v := range stmt.Vars {
-		cell := lookupVar(s, v)
+		cell := s.vars[v.Token.Val]
 		if cell == nil {
-			return NewRuntimeError(v.Token,
-				"Variable %v not defined", v.Token.Val)
+			return undefinedError(s, v.Token)
 		}
 		s.exports[v.Token.Val] = cell
 	}
@@ -179,49 +404,64 @@ func (s *FlatScope) copy() *FlatScope {
 		// deliberately don't copy exports
 		importer:  s.importer,
 		unimports: make(map[string]map[string]bool, len(s.unimports)),
+		readonly:  make(map[string]bool, len(s.readonly)),
+		imports:   make(map[string][]*ast.StmtImport, len(s.imports)),
+		blocks:    s.blocks,
 	}
 	for k, v := range s.vars {
 		c.vars[k] = v
 	}
+	for k, v := range s.readonly {
+		c.readonly[k] = v
+	}
 	for mod, vars := range s.unimports {
 		c.unimports[mod] = make(map[string]bool, len(vars))
 		for k, v := range vars {
 			c.unimports[mod][k] = v
 		}
 	}
+	for mod, stmts := range s.imports {
+		c.imports[mod] = append([]*ast.StmtImport(nil), stmts...)
+	}
 	return c
 }
 
 func (s *FlatScope) Fork() Scope    { return NewForkScope(s) }
 func (s *FlatScope) Flatten() Scope { return s.copy() }
 
-func (s *FlatScope) Import(path, prefix string) error {
-	if _, exists := s.unimports[path]; exists {
+func (s *FlatScope) Import(stmt *ast.StmtImport) error {
+	path := stmt.Path.Val
+	if _, exists := s.unimports[path]; exists &&
+		stmt.Select == nil && stmt.As == nil {
 		return fmt.Errorf("%#v already imported", path)
 	}
-	vals, err := s.importer.Import(path)
+	vals, err := s.importer.Import(stmt.Token.Line, path)
 	if err != nil {
 		return err
 	}
-	if prefix != "" {
-		prefix += "_"
+	bindings, err := importBindings(stmt, vals)
+	if err != nil {
+		return err
 	}
-	for v := range vals {
-		if d, exists := s.vars[prefix+v]; exists {
-			return fmt.Errorf(
-				"Export defines %#v, but %#v already defined on file %#v, line %d",
-				prefix+v, prefix+v, d.Def.Filename, d.Def.Lineno)
+	for _, b := range bindings {
+		if d, exists := s.vars[b.local]; exists {
+			return b.conflict(d)
 		}
 	}
-	unimports := make(map[string]bool, len(vals))
-	for v, cell := range vals {
-		s.vars[prefix+v] = &ValueCell{
-			Def: cell.Def,
-			Val: cell.Val,
+	mode := importMode(stmt)
+	unimports := s.unimports[path]
+	if unimports == nil {
+		unimports = make(map[string]bool, len(bindings))
+	}
+	for _, b := range bindings {
+		s.vars[b.local] = b.bind(mode)
+		if mode == ImportReadOnly {
+			s.readonly[b.local] = true
 		}
-		unimports[prefix+v] = true
+		unimports[b.local] = true
 	}
 	s.unimports[path] = unimports
+	s.imports[path] = append(s.imports[path], stmt)
 	return nil
 }
 
@@ -232,7 +472,13 @@ func (s *FlatScope) Unimport(path string) error {
 	}
 	for v := range vars {
 		delete(s.vars, v)
+		delete(s.readonly, v)
 	}
 	delete(s.unimports, path)
+	delete(s.imports, path)
 	return nil
 }
+
+func (s *FlatScope) Reload(stmt *ast.StmtReload) error {
+	return reload(s.importer, stmt)
+}
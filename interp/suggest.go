@@ -0,0 +1,104 @@
+package interp
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jtolds/pants2/ast"
+)
+
+func undefinedError(s Scope, tok *ast.Token) *RuntimeError {
+	return NewRuntimeError(tok, "Variable %v not defined%s", tok.Val,
+		didYouMean(tok.Val, s.Names()))
+}
+
+// didYouMean suggests the names closest to name, for the end of an error
+// message about name not existing. It returns "" if nothing is close enough
+// to be a likely typo.
+func didYouMean(name string, names []string) string {
+	suggestions := closestNames(name, names, 3)
+	if len(suggestions) == 0 {
+		return ""
+	}
+	for i := range suggestions {
+		suggestions[i] = fmt.Sprintf("%#v", suggestions[i])
+	}
+	if len(suggestions) == 1 {
+		return fmt.Sprintf(". Did you mean %s?", suggestions[0])
+	}
+	last := len(suggestions) - 1
+	return fmt.Sprintf(". Did you mean %s or %s?",
+		strings.Join(suggestions[:last], ", "), suggestions[last])
+}
+
+// closestNames returns up to limit names within a small edit distance of
+// name, closest first. Longer names are allowed more edits.
+func closestNames(name string, names []string, limit int) []string {
+	maxDist := (len([]rune(name)) + 1) / 3
+	type candidate struct {
+		name string
+		dist int
+	}
+	var candidates []candidate
+	for _, n := range names {
+		if n == name {
+			continue
+		}
+		if d := editDistance(name, n); d <= maxDist {
+			candidates = append(candidates, candidate{name: n, dist: d})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].dist != candidates[j].dist {
+			return candidates[i].dist < candidates[j].dist
+		}
+		return candidates[i].name < candidates[j].name
+	})
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+	rv := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		rv = append(rv, c.name)
+	}
+	return rv
+}
+
+// editDistance is the number of single letter insertions, deletions,
+// substitutions or swaps of neighboring letters it takes to turn a into b,
+// ignoring case, since a name typed in the wrong case is still a typo.
+func editDistance(a, b string) int {
+	ar := []rune(strings.ToLower(a))
+	br := []rune(strings.ToLower(b))
+	// d[i][j] is the distance between the first i runes of a and the first j
+	// runes of b
+	d := make([][]int, len(ar)+1)
+	for i := range d {
+		d[i] = make([]int, len(br)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(ar); i++ {
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			d[i][j] = minInt(minInt(d[i-1][j]+1, d[i][j-1]+1), d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ar[i-1] == br[j-2] && ar[i-2] == br[j-1] {
+				d[i][j] = minInt(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(ar)][len(br)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
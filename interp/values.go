@@ -1,21 +1,14 @@
 package interp
 
 import (
+	"context"
 	"fmt"
-	"strings"
 
 	"github.com/jtolds/pants2/ast"
-	"github.com/jtolds/pants2/lib/big"
 )
 
 type Value = ast.Value
 
-type ValNumber struct{ Val big.Rat }
-
-func (v ValNumber) String() string {
-	return strings.TrimRight(strings.TrimRight(v.Val.FloatString(10), "0"), ".")
-}
-
 type ValString struct{ Val string }
 
 func (v ValString) String() string { return v.Val }
@@ -35,30 +28,41 @@ type UserProc struct {
 	scope Scope
 	args  []*ast.Var
 	body  []ast.Stmt
+	code  *code
+	// captured holds the cells of the free names code uses, and clash is the
+	// index of an argument that is already defined where the procedure was,
+	// or -1.
+	captured []*ValueCell
+	clash    int
 }
 
 func (p *UserProc) value()         {}
 func (p *UserProc) String() string { return p.name }
 func (p *UserProc) Call(t *ast.Token, args []Value) error {
+	return p.call(NewBudget(Limits{}), t, args)
+}
+
+// call calls the procedure within the budget b.
+func (p *UserProc) call(b *Budget, t *ast.Token, args []Value) error {
 	if len(args) != len(p.args) {
 		return NewRuntimeError(t,
 			"Expected %d arguments but got %d", len(p.args), len(args))
 	}
-	for _, arg := range p.args {
-		if d := lookupVar(p.scope, arg); d != nil {
-			return NewRuntimeError(arg.Token,
-				"Variable %v already defined on file %#v, line %d",
-				arg.Token.Val, d.Def.Filename, d.Def.Lineno)
-		}
+	err := b.enter(t)
+	if err != nil {
+		return err
 	}
-	s := p.scope.Fork()
-	for i := range args {
-		s.Define(p.args[i].Token.Val, &ValueCell{
-			Def: p.args[i].Token.Line,
-			Val: args[i],
-		})
+	err = p.run(b, args)
+	b.leave()
+	return addFrame(err, p.String(), t)
+}
+
+func (p *UserProc) run(b *Budget, args []Value) error {
+	if p.clash >= 0 {
+		arg := p.args[p.clash]
+		return alreadyDefined(arg.Token, p.scope.Lookup(arg.Token.Val))
 	}
-	err := RunAll(s, p.body)
+	_, err := p.code.call(b, p.scope, p.captured, p.args, args)
 	if ce, ok := err.(*ControlError); ok {
 		switch ce.typ {
 		case CtrlBreak, CtrlNext, CtrlReturn:
@@ -78,6 +82,16 @@ func (f ProcCB) value()                                {}
 func (f ProcCB) String() string                        { return "<builtin>" }
 func (f ProcCB) Call(t *ast.Token, args []Value) error { return f(args) }
 
+// ProcCtxCB is a builtin procedure that blocks, like sleep. It is given the
+// context of the code calling it, and should return early once it is done.
+type ProcCtxCB func(ctx context.Context, args []Value) error
+
+func (f ProcCtxCB) value()         {}
+func (f ProcCtxCB) String() string { return "<builtin>" }
+func (f ProcCtxCB) Call(t *ast.Token, args []Value) error {
+	return f(context.Background(), args)
+}
+
 type ValFunc interface {
 	Call(t *ast.Token, args []Value) (Value, error)
 	Value
@@ -89,33 +103,66 @@ type UserFunc struct {
 	scope Scope
 	args  []*ast.Var
 	body  []ast.Stmt
+	code  *code
+	// captured and clash are as for UserProc, but for where the function
+	// was defined.
+	captured []*ValueCell
+	clash    int
 }
 
 func (f *UserFunc) value()         {}
 func (f *UserFunc) String() string { return f.name + "()" }
 func (f *UserFunc) Call(t *ast.Token, args []Value) (Value, error) {
+	return f.call(NewBudget(Limits{}), t, args)
+}
+
+// tailCall is what a function body returning a call to another function
+// hands back in place of making the call itself, so that chains of them run
+// one after the other instead of nesting. The traceback only shows the last.
+type tailCall struct {
+	fn    *UserFunc
+	token *ast.Token
+	args  []Value
+}
+
+func (tc *tailCall) Error() string { return "tail call to " + tc.fn.String() }
+
+// call calls the function within the budget b.
+func (f *UserFunc) call(b *Budget, t *ast.Token, args []Value) (Value, error) {
 	if len(args) != len(f.args) {
 		return nil, NewRuntimeError(t,
 			"Expected %d arguments but got %d", len(f.args), len(args))
 	}
-	for _, arg := range f.args {
-		if d := lookupVar(f.scope, arg); d != nil {
-			return nil, NewRuntimeError(arg.Token,
-				"Variable %v already defined on file %#v, line %d",
-				arg.Token.Val, d.Def.Filename, d.Def.Lineno)
+	err := b.enter(t)
+	if err != nil {
+		return nil, err
+	}
+	defer b.leave()
+	for {
+		rv, err := f.run(b, args)
+		tc, ok := err.(*tailCall)
+		if !ok {
+			if err != nil {
+				err = addFrame(err, f.String(), t)
+			}
+			return rv, err
+		}
+		f, t, args = tc.fn, tc.token, tc.args
+		if len(args) != len(f.args) {
+			return nil, NewRuntimeError(t,
+				"Expected %d arguments but got %d", len(f.args), len(args))
 		}
 	}
-	s := f.scope.Fork()
-	for i := range args {
-		s.Define(f.args[i].Token.Val, &ValueCell{
-			Def: f.args[i].Token.Line,
-			Val: args[i],
-		})
+}
+
+func (f *UserFunc) run(b *Budget, args []Value) (Value, error) {
+	if f.clash >= 0 {
+		arg := f.args[f.clash]
+		return nil, alreadyDefined(arg.Token, f.scope.Lookup(arg.Token.Val))
 	}
-	err := RunAll(s, f.body)
+	rv, err := f.code.call(b, f.scope, f.captured, f.args, args)
 	if err == nil {
-		return nil, NewRuntimeError(f.def,
-			"Function exited with no return statement")
+		return rv, nil
 	}
 	if ce, ok := err.(*ControlError); ok {
 		switch ce.typ {
@@ -136,6 +183,26 @@ func (f FuncCB) value()                                         {}
 func (f FuncCB) String() string                                 { return "<builtin>" }
 func (f FuncCB) Call(t *ast.Token, args []Value) (Value, error) { return f(args) }
 
+// ValModule is a module imported with IMPORT ... AS, whose exports are
+// reached through member access.
+type ValModule struct {
+	path  string
+	cells map[string]*ValueCell
+}
+
+func (m *ValModule) value()         {}
+func (m *ValModule) String() string { return fmt.Sprintf("<module %#v>", m.path) }
+
+func (m *ValModule) names() []string {
+	rv := make([]string, 0, len(m.cells))
+	for name := range m.cells {
+		rv = append(rv, name)
+	}
+	return rv
+}
+
+func (m *ValModule) Member(name string) *ValueCell { return m.cells[name] }
+
 func (v ValNumber) value() {}
 func (v ValString) value() {}
 func (v ValBool) value()   {}
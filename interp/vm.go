@@ -0,0 +1,514 @@
+package interp
+
+import (
+	"sync"
+
+	"github.com/jtolds/pants2/ast"
+)
+
+// frame is the working state of running some code: its value stack, its
+// variable slots and the block scopes it has entered. Frames are reused, and
+// so are their block scopes once the block they were made for is done, and
+// the cells in cells for code that owns its cells.
+type frame struct {
+	stack  []Value
+	slots  []*ValueCell
+	cells  []ValueCell
+	blocks []*ForkScope
+	root   ForkScope
+	// escaped holds the cells in slots that procedures defined while they
+	// were there captured. They live on after the frame, so they stay
+	// counted against the memory limit.
+	escaped map[*ValueCell]bool
+}
+
+var frames = sync.Pool{
+	New: func() interface{} { return &frame{stack: make([]Value, 0, 16)} },
+}
+
+func getFrame(c *code) *frame {
+	f := frames.Get().(*frame)
+	if cap(f.slots) < c.slots {
+		f.slots = make([]*ValueCell, c.slots)
+	}
+	f.slots = f.slots[:c.slots]
+	if c.ownCells {
+		if cap(f.cells) < c.slots {
+			f.cells = make([]ValueCell, c.slots)
+		}
+		f.cells = f.cells[:c.slots]
+	} else {
+		f.cells = f.cells[:0]
+	}
+	return f
+}
+
+// cell returns a cell for a variable in slot i to start out holding v.
+func (f *frame) cell(c *code, i int, def *ast.Line, v Value) *ValueCell {
+	if c.ownCells {
+		f.cells[i] = ValueCell{Def: def, Val: v}
+		return &f.cells[i]
+	}
+	return &ValueCell{Def: def, Val: v}
+}
+
+// release is done with the frame, and the variables in its slots.
+func (f *frame) release(b *Budget) {
+	f.root.forget()
+	for _, block := range f.blocks {
+		block.forget()
+	}
+	for i, cell := range f.slots {
+		if cell != nil {
+			f.drop(b, cell)
+			f.slots[i] = nil
+		}
+	}
+	for cell := range f.escaped {
+		delete(f.escaped, cell)
+	}
+	for i := range f.cells {
+		f.cells[i] = ValueCell{}
+	}
+	stack := f.stack[:cap(f.stack)]
+	for i := range stack {
+		stack[i] = nil
+	}
+	frames.Put(f)
+}
+
+// drop is done with the cell in a slot, unless a procedure captured it.
+func (f *frame) drop(b *Budget, cell *ValueCell) {
+	if b.limits.Memory > 0 && !f.escaped[cell] {
+		b.drop(cell.Val)
+	}
+}
+
+// escape records that the cells now in the slots are captured by a
+// procedure being defined.
+func (f *frame) escape() {
+	if f.escaped == nil {
+		f.escaped = map[*ValueCell]bool{}
+	}
+	for _, cell := range f.slots {
+		if cell != nil {
+			f.escaped[cell] = true
+		}
+	}
+}
+
+// exec runs compiled code at the top level of the scope s, within the budget
+// b. Function bodies return the value handed back by their
+// return statement.
+func (c *code) exec(s Scope, b *Budget) (Value, error) {
+	f := getFrame(c)
+	rv, err := f.exec(c, s, nil, b)
+	f.release(b)
+	return rv, err
+}
+
+// call runs a procedure or function body with the given arguments. scope is
+// what the procedure captured when it was defined, and captured holds the
+// cells of the body's free names.
+func (c *code) call(b *Budget, scope Scope, captured []*ValueCell,
+	params []*ast.Var, args []Value) (Value, error) {
+	f := getFrame(c)
+	f.root.init(scope, c.root.names, f.slots)
+	for i, param := range params {
+		if err := b.hold(param.Token, nil, args[i]); err != nil {
+			f.release(b)
+			return nil, err
+		}
+		f.slots[c.params[i]] = f.cell(c, c.params[i], param.Token.Line, args[i])
+	}
+	rv, err := f.exec(c, &f.root, captured, b)
+	f.release(b)
+	return rv, err
+}
+
+func (f *frame) exec(c *code, s Scope, captured []*ValueCell, b *Budget) (
+	Value, error) {
+	var (
+		stack = f.stack[:0]
+		slots = f.slots
+		depth int
+		cur   = s
+	)
+	// if the stack grows past what the frame has, the bigger one is left
+	// for the garbage collector, as keeping it would take a defer here
+
+	for pc := 0; pc < len(c.instrs); pc++ {
+		in := c.instrs[pc]
+		switch in.op {
+		case opStep:
+			err := b.step(c.tokens[in.a])
+			if err != nil {
+				return nil, err
+			}
+
+		case opConst:
+			stack = append(stack, c.consts[in.a])
+
+		case opNil:
+			stack = append(stack, nil)
+
+		case opLoadSlot, opLoadCaptured, opLoadName:
+			var cell *ValueCell
+			var t *ast.Token
+			switch in.op {
+			case opLoadSlot:
+				cell, t = slots[in.a], c.tokens[in.b]
+			case opLoadCaptured:
+				cell, t = captured[in.a], c.tokens[in.b]
+			default:
+				t = c.tokens[in.a]
+				cell = cur.Lookup(t.Val)
+			}
+			if cell == nil {
+				return nil, undefinedError(cur, t)
+			}
+			if cell.Val == nil {
+				return nil, NewRuntimeError(t,
+					"Variable %v defined but not initialized", t.Val)
+			}
+			stack = append(stack, cell.Val)
+
+		case opCheckNew:
+			t := c.tokens[in.b]
+			if d := lookup(cur, slots, captured, c.refs[in.a], t.Val); d != nil {
+				return nil, alreadyDefined(t, d)
+			}
+
+		case opDefineSlot:
+			t := c.tokens[in.b]
+			if err := b.hold(t, nil, stack[len(stack)-1]); err != nil {
+				return nil, err
+			}
+			cur.(*ForkScope).setSlot(int(in.a), t.Val,
+				f.cell(c, int(in.a), t.Line, stack[len(stack)-1]))
+			stack = stack[:len(stack)-1]
+
+		case opDefineName:
+			t := c.tokens[in.a]
+			if err := b.hold(t, nil, stack[len(stack)-1]); err != nil {
+				return nil, err
+			}
+			cur.Define(t.Val, &ValueCell{Def: t.Line, Val: stack[len(stack)-1]})
+			stack = stack[:len(stack)-1]
+
+		case opCheckSet:
+			t := c.tokens[in.b]
+			r := c.refs[in.a]
+			d := lookup(cur, slots, captured, r, t.Val)
+			if d == nil {
+				return nil, undefinedError(cur, t)
+			}
+			// only imports are read-only, and they aren't kept in slots
+			if r.kind != refSlot && cur.ReadOnly(t.Val) {
+				return nil, NewRuntimeError(t,
+					"Variable %v is a read-only import, defined on file %#v, line %d",
+					t.Val, d.Def.Filename, d.Def.Lineno)
+			}
+
+		case opStoreSlot, opStoreCaptured, opStoreName:
+			var cell *ValueCell
+			var t *ast.Token
+			switch in.op {
+			case opStoreSlot:
+				cell, t = slots[in.a], c.tokens[in.b]
+			case opStoreCaptured:
+				cell, t = captured[in.a], c.tokens[in.b]
+			default:
+				t = c.tokens[in.a]
+				cell = cur.Lookup(t.Val)
+			}
+			if err := b.hold(t, cell.Val, stack[len(stack)-1]); err != nil {
+				return nil, err
+			}
+			cell.Val = stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+
+		case opNot:
+			test, ok := stack[len(stack)-1].(ValBool)
+			if !ok {
+				return nil, NewRuntimeError(c.tokens[in.a],
+					"not statement requires a truth value, got %#v instead.",
+					stack[len(stack)-1])
+			}
+			stack[len(stack)-1] = ValBool{Val: !test.Val}
+
+		case opNeg:
+			val, ok := stack[len(stack)-1].(ValNumber)
+			if !ok {
+				return nil, NewRuntimeError(c.tokens[in.a],
+					"negative requires a number, got %#v instead.",
+					stack[len(stack)-1])
+			}
+			stack[len(stack)-1] = val.neg().box()
+
+		case opBinary, opArith:
+			if in.op == opArith && b.limits.Memory > 0 {
+				err := b.reserve(c.tokens[in.b],
+					Size(stack[len(stack)-2])+Size(stack[len(stack)-1]))
+				if err != nil {
+					return nil, err
+				}
+			}
+			rv, err := c.methods[in.a](c.tokens[in.b],
+				stack[len(stack)-2], stack[len(stack)-1])
+			if err != nil {
+				return nil, err
+			}
+			stack = stack[:len(stack)-1]
+			stack[len(stack)-1] = rv
+
+		case opAnd, opOr:
+			left, ok := stack[len(stack)-1].(ValBool)
+			if !ok {
+				op := "and"
+				if in.op == opOr {
+					op = "or"
+				}
+				return nil, NewRuntimeError(c.tokens[in.b],
+					"Operation \"%s\" expects truth value on left side.", op)
+			}
+			if left.Val == (in.op == opOr) {
+				pc = int(in.a) - 1
+			} else {
+				stack = stack[:len(stack)-1]
+			}
+
+		case opMember:
+			rv, err := member(stack[len(stack)-1], c.exprs[in.a].(*ast.ExprMember))
+			if err != nil {
+				return nil, err
+			}
+			stack[len(stack)-1] = rv
+
+		case opIndex:
+			return nil, NewRuntimeError(c.tokens[in.a],
+				"Indexing is not supported")
+
+		case opCheckProc:
+			if _, ok := stack[len(stack)-1].(ValProc); !ok {
+				return nil, NewRuntimeError(c.calls[in.a].token,
+					"Procedure call without procedure value. Unexpected value %s",
+					stack[len(stack)-1])
+			}
+
+		case opCallProc:
+			base := len(stack) - int(in.b)
+			var err error
+			switch proc := stack[base-1].(type) {
+			case *UserProc:
+				err = proc.call(b, c.calls[in.a].token, stack[base:])
+			case ProcCtxCB:
+				err = proc(b.ctx, builtinArgs(stack[base:]))
+				if err != nil && b.ctx.Err() != nil {
+					err = b.check(c.calls[in.a].token)
+				}
+			case ValProc:
+				err = proc.Call(c.calls[in.a].token, builtinArgs(stack[base:]))
+			}
+			stack = stack[:base-1]
+			if err != nil {
+				return nil, builtinError(c.calls[in.a].token, c.calls[in.a].callee, err)
+			}
+
+		case opCheckFunc:
+			if _, ok := stack[len(stack)-1].(ValFunc); !ok {
+				return nil, NewRuntimeError(c.calls[in.a].token,
+					"Function call without function value. Unexpected value %s",
+					stack[len(stack)-1])
+			}
+
+		case opCallFunc, opTailCall:
+			base := len(stack) - int(in.b)
+			if fn, ok := stack[base-1].(*UserFunc); ok && in.op == opTailCall {
+				return nil, &tailCall{fn: fn, token: c.calls[in.a].token,
+					args: append([]Value(nil), stack[base:]...)}
+			}
+			var rv Value
+			var err error
+			switch fn := stack[base-1].(type) {
+			case *UserFunc:
+				rv, err = fn.call(b, c.calls[in.a].token, stack[base:])
+			case ValFunc:
+				rv, err = fn.Call(c.calls[in.a].token, builtinArgs(stack[base:]))
+				if err == nil {
+					err = b.reserve(c.calls[in.a].token, Size(rv))
+				}
+			}
+			stack = stack[:base-1]
+			if err != nil {
+				return nil, builtinError(c.calls[in.a].token, c.calls[in.a].callee, err)
+			}
+			stack = append(stack, rv)
+
+		case opJump:
+			pc = int(in.a) - 1
+
+		case opIfFalse, opWhileFalse:
+			val := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			test, ok := val.(ValBool)
+			if !ok {
+				stmt := "if"
+				if in.op == opWhileFalse {
+					stmt = "while"
+				}
+				return nil, NewRuntimeError(c.tokens[in.b],
+					"%s statement requires a truth value, got %#v instead.", stmt, val)
+			}
+			if !test.Val {
+				pc = int(in.a) - 1
+			}
+
+		case opEnter:
+			if depth == len(f.blocks) {
+				f.blocks = append(f.blocks, new(ForkScope))
+			}
+			info := c.blocks[in.a]
+			for _, slot := range info.slots {
+				if slots[slot] != nil {
+					f.drop(b, slots[slot])
+					slots[slot] = nil
+				}
+			}
+			f.blocks[depth].init(cur, info.names, slots)
+			cur = f.blocks[depth]
+			depth++
+
+		case opLeave, opLeaveTo:
+			if in.op == opLeave {
+				depth--
+			} else {
+				depth = int(in.a)
+			}
+			if depth == 0 {
+				cur = s
+			} else {
+				cur = f.blocks[depth-1]
+			}
+
+		case opDefine:
+			d := c.defs[in.a]
+			cell := lookup(cur, slots, captured, d.dest, d.name.Val)
+			// the definition flattens the scope, but the scope it flattens
+			// needs the definition in it so recursion works
+			scope := cur.Flatten()
+			if b.limits.Memory > 0 {
+				f.escape()
+			}
+			free := make([]*ValueCell, len(d.body.free))
+			for i, name := range d.body.free {
+				free[i] = scope.Lookup(name)
+			}
+			switch stmt := d.stmt.(type) {
+			case *ast.StmtProcDef:
+				cell.Val = &UserProc{
+					def:      stmt.Token,
+					name:     d.name.Val,
+					scope:    scope,
+					args:     stmt.Args,
+					body:     stmt.Body,
+					code:     d.body,
+					captured: free,
+					clash:    clash(scope, stmt.Args)}
+			case *ast.StmtFuncDef:
+				cell.Val = &UserFunc{
+					def:      stmt.Token,
+					name:     d.name.Val,
+					scope:    scope,
+					args:     stmt.Args,
+					body:     stmt.Body,
+					code:     d.body,
+					captured: free,
+					clash:    clash(scope, stmt.Args)}
+			}
+
+		case opStmt:
+			gone := undefined(cur, c.stmts[in.a])
+			err := runStmt(cur, c.stmts[in.a])
+			if err != nil {
+				return nil, err
+			}
+			for _, val := range gone {
+				b.drop(val)
+			}
+
+		case opReturn:
+			if c.fn {
+				return stack[len(stack)-1], nil
+			}
+			return nil, NewControlError(c.tokens[in.a], stack[len(stack)-1])
+
+		case opNoReturn:
+			return nil, NewRuntimeError(c.tokens[in.a],
+				"Function exited with no return statement")
+
+		case opControl:
+			return nil, NewControlError(c.tokens[in.a], nil)
+
+		default:
+			panic("unknown opcode")
+		}
+	}
+	return nil, nil
+}
+
+// lookup finds the cell of the variable r refers to, or nil if it isn't
+// defined.
+func lookup(s Scope, slots, captured []*ValueCell, r ref,
+	name string) *ValueCell {
+	switch r.kind {
+	case refSlot:
+		return slots[r.index]
+	case refCaptured:
+		return captured[r.index]
+	case refName:
+		return s.Lookup(name)
+	default:
+		return nil
+	}
+}
+
+// undefined returns the values of the module variables stmt undefines, if
+// it is an undefine statement. Imports are held by the module they come from,
+// and variables in slots are dropped with their frame instead.
+func undefined(s Scope, stmt ast.Stmt) []Value {
+	u, ok := stmt.(*ast.StmtUndefine)
+	if !ok {
+		return nil
+	}
+	flat, ok := s.(*FlatScope)
+	if !ok {
+		return nil
+	}
+	var rv []Value
+	for _, v := range u.Vars {
+		if cell := flat.Lookup(v.Token.Val); cell != nil &&
+			!flat.imported(v.Token.Val) {
+			rv = append(rv, cell.Val)
+		}
+	}
+	return rv
+}
+
+// clash returns the index of the first argument whose name is already
+// defined in the scope a procedure captured, or -1 if there isn't one.
+func clash(scope Scope, args []*ast.Var) int {
+	for i, arg := range args {
+		if scope.Lookup(arg.Token.Val) != nil {
+			return i
+		}
+	}
+	return -1
+}
+
+// builtinArgs copies the arguments to a builtin, in case it holds on to
+// them. Procedures and functions written in pants2 are done with theirs once
+// they have defined them.
+func builtinArgs(args []Value) []Value {
+	return append([]Value(nil), args...)
+}
@@ -1,12 +1,19 @@
 package main
 
 import (
+	"bufio"
+	"errors"
 	"flag"
+	"fmt"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"runtime"
 	"runtime/pprof"
 
 	"github.com/jtolds/pants2/app"
+	"github.com/jtolds/pants2/ast"
+	"github.com/jtolds/pants2/interp"
 	"github.com/jtolds/pants2/mods/std"
 	"github.com/jtolds/pants2/mods/vis2d"
 )
@@ -18,14 +25,28 @@ var (
 
 func main() {
 	err := Main()
+	if err == errCheckFailed {
+		os.Exit(1)
+	}
 	if err != nil {
-		panic(err)
+		fmt.Fprintln(os.Stderr, err)
+		if tb := interp.Traceback(err); tb != "" {
+			fmt.Fprintln(os.Stderr, tb)
+		}
+		os.Exit(1)
 	}
 }
 
 func Main() error {
 	flag.Parse()
 
+	switch flag.Arg(0) {
+	case "mod":
+		return modCommand(flag.Args()[1:])
+	case "check":
+		return checkCommand(flag.Args()[1:])
+	}
+
 	if *cpuProfile != "" {
 		f, err := os.Create(*cpuProfile)
 		if err != nil {
@@ -37,9 +58,19 @@ func Main() error {
 	}
 
 	a := app.NewApp()
+	a.SetSearchPath(filepath.SplitList(os.Getenv("PANTS2PATH"))...)
+	a.SetMessages(os.Stderr)
+	if dir, err := app.DefaultParseCacheDir(); err == nil {
+		a.SetParseCache(&app.ParseCache{Dir: dir})
+	}
+	err := useManifest(a, filepath.Dir(flag.Arg(0)))
+	if err != nil {
+		return err
+	}
 	a.DefineModule("std", std.Mod)
 	a.DefineModule("vis2d", vis2d.Mod)
-	err := a.RunInDefaultScope(`import "vis2d"; import "std";`)
+	a.DefineModuleSource("vis2d/ext", vis2d.Ext)
+	err = a.RunInDefaultScope(`import "vis2d"; import "std";`)
 	if err != nil {
 		return err
 	}
@@ -51,6 +82,15 @@ func Main() error {
 			_, apperr = a.LoadFile(file)
 			return
 		}
+		// Ctrl-C stops the statement running instead of the interpreter
+		interrupts := make(chan os.Signal, 1)
+		signal.Notify(interrupts, os.Interrupt)
+		defer signal.Stop(interrupts)
+		go func() {
+			for range interrupts {
+				a.Interrupt()
+			}
+		}()
 		_, apperr = a.LoadInteractive(os.Stdin, os.Stderr)
 	}()
 	vis2d.Run()
@@ -69,3 +109,71 @@ func Main() error {
 
 	return apperr
 }
+
+func useManifest(a *app.App, dir string) error {
+	m, err := app.FindManifest(dir)
+	if err != nil || m == nil {
+		return err
+	}
+	cacheDir, err := app.DefaultCacheDir()
+	if err != nil {
+		return err
+	}
+	return a.SetManifest(m, &app.Cache{Dir: cacheDir})
+}
+
+func modCommand(args []string) error {
+	if len(args) != 1 || args[0] != "vendor" {
+		return fmt.Errorf("usage: pants2 mod vendor")
+	}
+	m, err := app.FindManifest(".")
+	if err != nil {
+		return err
+	}
+	if m == nil {
+		return fmt.Errorf("no %s found", app.ManifestName)
+	}
+	cacheDir, err := app.DefaultCacheDir()
+	if err != nil {
+		return err
+	}
+	return app.Vendor(m, &app.Cache{Dir: cacheDir})
+}
+
+// errCheckFailed is returned by checkCommand once it has reported the syntax
+// errors it found.
+var errCheckFailed = errors.New("check failed")
+
+// checkCommand reports every syntax error in the given files, without running
+// them.
+func checkCommand(files []string) error {
+	if len(files) == 0 {
+		return fmt.Errorf("usage: pants2 check <file>...")
+	}
+	failed := false
+	for _, file := range files {
+		fh, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		_, err = ast.ParseAll(ast.NewTokenSource(
+			ast.NewReaderLineSource(file, bufio.NewReader(fh), nil)))
+		fh.Close()
+		if err != nil {
+			errs, ok := err.(ast.SyntaxErrors)
+			if !ok {
+				return err
+			}
+			for _, serr := range errs {
+				filename, lineno, char := serr.Pos()
+				fmt.Fprintf(os.Stderr, "%s:%d:%d: %s\n",
+					filename, lineno, char, serr.Msg())
+			}
+			failed = true
+		}
+	}
+	if failed {
+		return errCheckFailed
+	}
+	return nil
+}
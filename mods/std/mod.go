@@ -2,6 +2,7 @@ package std
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	"fmt"
 	"io"
@@ -18,9 +19,7 @@ func Time(args []interp.Value) (interp.Value, error) {
 	if len(args) != 0 {
 		return nil, fmt.Errorf("unexpected arguments")
 	}
-	var rv interp.ValNumber
-	rv.Val.SetInt64(time.Now().UnixNano())
-	return &rv, nil
+	return interp.NewInt(time.Now().UnixNano()), nil
 }
 
 func Input(args []interp.Value) (interp.Value, error) {
@@ -78,12 +77,12 @@ func Number(args []interp.Value) (interp.Value, error) {
 	}
 	switch arg := args[0].(type) {
 	case interp.ValString:
-		var rv interp.ValNumber
-		_, ok := rv.Val.SetString(strings.TrimSpace(arg.Val))
+		var rv big.Rat
+		_, ok := rv.SetString(strings.TrimSpace(arg.Val))
 		if !ok {
 			return nil, fmt.Errorf("could not convert value to number: %#v", arg)
 		}
-		return &rv, nil
+		return interp.NewNumber(&rv), nil
 	case interp.ValNumber:
 		return arg, nil
 	default:
@@ -97,39 +96,39 @@ func Random(args []interp.Value) (interp.Value, error) {
 	if len(args) != 2 {
 		return nil, fmt.Errorf("expected two arguments")
 	}
-	low, ok := args[0].(interp.ValNumber)
+	lowarg, ok := args[0].(interp.ValNumber)
 	if !ok {
 		return nil, fmt.Errorf("first argument should be a number")
 	}
-	if one.Cmp(low.Val.Denom()) != 0 {
+	low := lowarg.Rat()
+	if one.Cmp(low.Denom()) != 0 {
 		return nil, fmt.Errorf("first argument should be an integer")
 	}
-	high, ok := args[1].(interp.ValNumber)
+	higharg, ok := args[1].(interp.ValNumber)
 	if !ok {
 		return nil, fmt.Errorf("second argument should be a number")
 	}
-	if one.Cmp(high.Val.Denom()) != 0 {
+	high := higharg.Rat()
+	if one.Cmp(high.Denom()) != 0 {
 		return nil, fmt.Errorf("second argument should be an integer")
 	}
 
 	var r, s stdbig.Int
-	r.SetBytes(high.Val.Num().Bytes())
-	s.SetBytes(low.Val.Num().Bytes())
+	r.SetBytes(high.Num().Bytes())
+	s.SetBytes(low.Num().Bytes())
 	// TODO: make sure r.Sub(&r, &s) is not greater than what fits in int64
 	z, err := rand.Int(rand.Reader, r.Sub(&r, &s))
 	if err != nil {
 		return nil, err
 	}
-	var rv interp.ValNumber
 	var im big.Rat
 	var num big.Int
 	num.SetBytes(z.Bytes())
 	im.SetInt(&num)
-	rv.Val.Add(&im, &low.Val)
-	return &rv, nil
+	return interp.NewNumber(im.Add(&im, low)), nil
 }
 
-func Sleep(args []interp.Value) error {
+func Sleep(ctx context.Context, args []interp.Value) error {
 	if len(args) != 1 {
 		return fmt.Errorf("expected one argument")
 	}
@@ -141,10 +140,16 @@ func Sleep(args []interp.Value) error {
 	var mul big.Rat
 	mul.SetInt64(int64(time.Second))
 	var z big.Rat
-	z.Mul(&seconds.Val, &mul)
+	z.Mul(seconds.Rat(), &mul)
 	ns, _ := z.Float64()
-	time.Sleep(time.Duration(int64(ns)))
-	return nil
+	timer := time.NewTimer(time.Duration(int64(ns)))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 func Mod() (map[string]interp.Value, error) {
@@ -152,7 +157,7 @@ func Mod() (map[string]interp.Value, error) {
 		// "print":   interp.ProcCB(Print),
 		// "println": interp.ProcCB(Println),
 		"log":    interp.ProcCB(Println),
-		"sleep":  interp.ProcCB(Sleep),
+		"sleep":  interp.ProcCtxCB(Sleep),
 		"time":   interp.FuncCB(Time),
 		"input":  interp.FuncCB(Input),
 		"number": interp.FuncCB(Number),
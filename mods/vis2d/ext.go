@@ -0,0 +1,11 @@
+package vis2d
+
+import (
+	_ "embed"
+)
+
+// Ext is the source of the "vis2d/ext" module, which implements line, rect,
+// circle and polygon in pants on top of pixel.
+//
+//go:embed ext.p
+var Ext []byte
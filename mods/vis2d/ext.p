@@ -1,19 +1,6 @@
-proc fill x1, y1, x2, y2 {
-  if x2 < x1 {
-    var x2t = x2; x2 = x1; x1 = x2t
-    var y2t = y2; y2 = y1; y1 = y2t
-  }
+# drawing helpers for vis2d, built on top of pixel.
 
-  var i = y1;
-  while i < y2 {
-    var j = x1;
-    while j < x2 {
-      pixel j, i
-      j = j + 1
-    }
-    i = i + 1
-  }
-}
+import "vis2d" as vis
 
 func intdiv(x, y) {
   var m = x % y
@@ -21,6 +8,58 @@ func intdiv(x, y) {
   return m / y
 }
 
+# the largest integer no bigger than x
+func floor(x) {
+  var lo = 0, hi = 1
+  if x < 0 {
+    lo = -1
+    hi = 0
+    while lo > x {
+      lo = lo * 2
+    }
+  } else {
+    while hi <= x {
+      hi = hi * 2
+    }
+  }
+  while hi - lo > 1 {
+    var mid = intdiv(lo + hi, 2)
+    if mid <= x {
+      lo = mid
+    } else {
+      hi = mid
+    }
+  }
+  return lo
+}
+
+func round(x) {
+  return floor(x + 1 / 2)
+}
+
+var pi = 355 / 113
+
+# cos and sin expect an angle between -pi and pi
+func cos(a) {
+  var term = 1, sum = 1, i = 1
+  while i < 12 {
+    term = -term * a * a / ((2 * i - 1) * (2 * i))
+    sum = sum + term
+    i = i + 1
+  }
+  return sum
+}
+
+func sin(a) {
+  var term = a, sum = a, i = 1
+  while i < 12 {
+    term = -term * a * a / ((2 * i) * (2 * i + 1))
+    sum = sum + term
+    i = i + 1
+  }
+  return sum
+}
+
 proc line x1, y1, x2, y2 {
   if x2 < x1 {
     var x2t = x2; x2 = x1; x1 = x2t
@@ -41,14 +80,77 @@ proc line x1, y1, x2, y2 {
       ynext = ynext + intdiv(ywidth * num, denom)
     }
     while y != ynext {
-      pixel x, y
+      vis.pixel x, y
       y = y + ydir
     }
     if y == ynext {
-      pixel x, y
+      vis.pixel x, y
     }
     x = x + 1
   }
 }
 
-export line, fill, intdiv
+# fills the rectangle from x1, y1 up to but not including x2, y2
+proc fill x1, y1, x2, y2 {
+  if x2 < x1 {
+    var x2t = x2; x2 = x1; x1 = x2t
+    var y2t = y2; y2 = y1; y1 = y2t
+  }
+
+  var i = y1;
+  while i < y2 {
+    var j = x1;
+    while j < x2 {
+      vis.pixel j, i
+      j = j + 1
+    }
+    i = i + 1
+  }
+}
+
+proc rect x1, y1, x2, y2 {
+  line x1, y1, x2, y1
+  line x2, y1, x2, y2
+  line x2, y2, x1, y2
+  line x1, y2, x1, y1
+}
+
+proc circle cx, cy, r {
+  var x = r, y = 0, err = 1 - r
+  while x >= y {
+    vis.pixel cx + x, cy + y
+    vis.pixel cx + y, cy + x
+    vis.pixel cx - y, cy + x
+    vis.pixel cx - x, cy + y
+    vis.pixel cx - x, cy - y
+    vis.pixel cx - y, cy - x
+    vis.pixel cx + y, cy - x
+    vis.pixel cx + x, cy - y
+    y = y + 1
+    if err < 0 {
+      err = err + 2 * y + 1
+    } else {
+      x = x - 1
+      err = err + 2 * (y - x) + 1
+    }
+  }
+}
+
+# a regular polygon with the given number of sides, centered on cx, cy with
+# its first corner straight up, r pixels away.
+proc polygon cx, cy, r, sides {
+  var i = 0, px = cx, py = cy - r
+  while i < sides {
+    i = i + 1
+    var a = 2 * pi * i / sides - pi / 2
+    if a > pi {
+      a = a - 2 * pi
+    }
+    var nx = round(cx + r * cos(a)), ny = round(cy + r * sin(a))
+    line px, py, nx, ny
+    px = nx
+    py = ny
+  }
+}
+
+export line, fill, intdiv, rect, circle, polygon
@@ -100,8 +100,7 @@ func (m *mod) Color(args []interp.Value) error {
 
 func toInt(arg interp.Value) int {
 	// TODO: handle overflow
-	xv := arg.(interp.ValNumber).Val
-	xf, _ := xv.Float64()
+	xf, _ := arg.(interp.ValNumber).Float64()
 	return int(xf)
 }
 
@@ -167,7 +166,7 @@ func tostr(args []interp.Value) (string, error) {
 	for _, arg := range args {
 		switch arg := arg.(type) {
 		case interp.ValNumber:
-			vals = append(vals, arg.Val.RatString())
+			vals = append(vals, arg.Rat().RatString())
 		case interp.ValString:
 			vals = append(vals, arg.Val)
 		case interp.ValBool:
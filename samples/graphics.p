@@ -1,6 +1,6 @@
 #!/usr/bin/env pants2
 
-import "./mods/vis2d/ext.p"
+import "vis2d/ext"
 
 proc box x, y {
   color "green"
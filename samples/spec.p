@@ -33,8 +33,14 @@ WHILE <expr> {
 }
 
 IMPORT <mod>
+IMPORT <mod> AS x
 IMPORT <mod> WITHPREFIX x.
+IMPORT <mod> ONLY <var>, <var>
+IMPORT <mod> USE <var> AS <var>, <var>
+IMPORT <mod> READONLY
+IMPORT <mod> SNAPSHOT
 UNIMPORT <mod>
+RELOAD <mod>
 UNDEFINE <var>, <var>
 EXPORT <var>, <var>
 
@@ -63,6 +69,7 @@ parenthesis
 >=
 
 var[index]
+mod.var
 
 # standard module
 
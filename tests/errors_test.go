@@ -0,0 +1,147 @@
+package tests
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/jtolds/pants2/interp"
+	"github.com/jtolds/pants2/lib/big"
+	"github.com/jtolds/pants2/mods/std"
+)
+
+func TestErrorSnippet(t *testing.T) {
+	_, err := loadWithMods(t, nil, "var total = 1\nproc show {\n\tlog total + nope\n}\nshow\n")
+	assertTrue(t, err != nil)
+	assertTrue(t, strings.HasSuffix(err.Error(),
+		"\n    log total + nope\n                ^^^^"))
+
+	_, err = loadWithMods(t, nil, "var x = 1 @ 2")
+	assertTrue(t, err != nil)
+	assertTrue(t, strings.HasSuffix(err.Error(),
+		"\n    var x = 1 @ 2\n              ^"))
+}
+
+func TestDidYouMean(t *testing.T) {
+	_, err := loadWithMods(t, nil, `
+		var count = 1, counter = 2, total = 3
+		proc show {
+			log coutn
+		}
+		show`)
+	assertTrue(t, err != nil)
+	assertTrue(t, strings.Contains(err.Error(),
+		`Variable coutn not defined. Did you mean "count"?`))
+
+	_, err = loadWithMods(t, nil, `
+		var count = 1, Count = 2, counts = 3
+		cuont = 4`)
+	assertTrue(t, err != nil)
+	assertTrue(t, strings.Contains(err.Error(),
+		`Did you mean "Count", "count" or "counts"?`))
+
+	_, err = loadWithMods(t, map[string]string{"counter.p": counterMod}, `
+		import "counter.p" as c
+		c.bmup`)
+	assertTrue(t, err != nil)
+	assertTrue(t, strings.Contains(err.Error(),
+		`does not export "bmup". Did you mean "bump"?`))
+
+	_, err = loadWithMods(t, nil, `
+		var apple = 1
+		log xyz`)
+	assertTrue(t, err != nil)
+	assertTrue(t, !strings.Contains(err.Error(), "Did you mean"))
+}
+
+func TestTraceback(t *testing.T) {
+	_, err := loadWithMods(t, nil, `func fact(n) {
+  if n == 0 {
+    return 1 / 0
+  }
+  return n * fact(n - 1)
+}
+proc show x {
+  var r = fact(x)
+}
+show 10`)
+	assertTrue(t, err != nil)
+	assertTrue(t, strings.Contains(err.Error(), "line 3: Division by zero"))
+	tb := interp.Traceback(err)
+	lines := strings.Split(tb, "\n")
+	assertTrue(t, len(lines) == 7)
+	for _, line := range lines[1:4] {
+		assertTrue(t, line == `  fact(), called on file "test", line 5: return n * fact(n - 1)`)
+	}
+	assertTrue(t, lines[4] == "  ... the same call repeated 7 more times")
+	assertTrue(t, lines[5] == `  fact(), called on file "test", line 8: var r = fact(x)`)
+	assertTrue(t, lines[6] == `  show, called on file "test", line 10: show 10`)
+
+	_, err = loadWithMods(t, nil, `var x = nope`)
+	assertTrue(t, err != nil && interp.Traceback(err) == "")
+}
+
+func TestBuiltinErrors(t *testing.T) {
+	_, err := loadWithMods(t, nil, `
+		var n = number("12") * 2
+		var m = number("twelve")`)
+	assertTrue(t, interp.IsRuntimeError(err))
+	assertTrue(t, strings.Contains(err.Error(),
+		`line 3: number: could not convert value to number`))
+
+	_, err = loadWithMods(t, nil, `sleep "soon"`)
+	assertTrue(t, interp.IsRuntimeError(err))
+	assertTrue(t, strings.Contains(err.Error(),
+		"line 1: sleep: argument should be a number"))
+
+	var out bytes.Buffer
+	a := newApp()
+	a.DefineModule("std", std.Mod)
+	assertNoErr(t, a.RunInDefaultScope(`import "std";`))
+	vals, err := a.LoadInteractive(strings.NewReader(`
+		var x = number("x")
+		var y = 1
+		export y
+		`), &out)
+	assertNoErr(t, err)
+	assertNumEqual(t, vals["y"].Val, big.NewRat(1, 1))
+	assertTrue(t, strings.Contains(out.String(), "number: could not convert"))
+}
+
+func TestUndefinedBeforeRunning(t *testing.T) {
+	_, err := loadWithMods(t, nil, `
+		var ran = false
+		proc never {
+			log missing
+		}
+		ran = true`)
+	assertTrue(t, err != nil)
+	assertTrue(t, strings.Contains(err.Error(),
+		`line 4: Variable missing not defined`))
+
+	vals, err := loadWithMods(t, nil, `
+		var total = 0
+		proc add x {
+			total = total + x
+		}
+		add 2
+		add 3
+		if true {
+			var inner = total
+			undefine inner
+			var inner = 1
+			total = total + inner
+		}
+		export total`)
+	assertNoErr(t, err)
+	assertNumEqual(t, vals["total"].Val, big.NewRat(6, 1))
+}
+
+func TestIndexing(t *testing.T) {
+	_, err := loadWithMods(t, nil, `
+		var s = "ab"
+		var c = s[0]`)
+	assertTrue(t, interp.IsRuntimeError(err))
+	assertTrue(t, strings.Contains(err.Error(),
+		"line 3: Indexing is not supported"))
+}
@@ -0,0 +1,71 @@
+package tests
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/jtolds/pants2/interp"
+	"github.com/jtolds/pants2/mods/vis2d"
+)
+
+func drawExt(t *testing.T, code string) map[string]bool {
+	t.Helper()
+	pixels := map[string]bool{}
+	a := newApp()
+	a.DefineModule("vis2d", func() (map[string]interp.Value, error) {
+		return map[string]interp.Value{
+			"pixel": interp.ProcCB(func(args []interp.Value) error {
+				pixels[fmt.Sprintf("%s,%s", args[0], args[1])] = true
+				return nil
+			}),
+		}, nil
+	})
+	a.DefineModuleSource("vis2d/ext", vis2d.Ext)
+	_, err := a.Load("test", bytes.NewReader([]byte(
+		`import "vis2d/ext"`+"\n"+code)))
+	assertNoErr(t, err)
+	return pixels
+}
+
+func assertPixels(t *testing.T, pixels map[string]bool, expected ...string) {
+	t.Helper()
+	for _, p := range expected {
+		if !pixels[p] {
+			t.Fatalf("pixel %s not drawn", p)
+		}
+	}
+}
+
+func TestExtLine(t *testing.T) {
+	pixels := drawExt(t, `line 3, 1, 0, 4`)
+	assertTrue(t, len(pixels) == 7)
+	assertPixels(t, pixels, "0,4", "1,3", "2,2", "3,1")
+}
+
+func TestExtFill(t *testing.T) {
+	pixels := drawExt(t, `fill 1, 1, 3, 4`)
+	assertTrue(t, len(pixels) == 6)
+	assertPixels(t, pixels, "1,1", "2,1", "1,3", "2,3")
+
+	pixels = drawExt(t, `fill 0, 0, intdiv(7, 2), 1`)
+	assertTrue(t, len(pixels) == 3)
+}
+
+func TestExtRect(t *testing.T) {
+	pixels := drawExt(t, `rect 1, 1, 3, 4`)
+	assertTrue(t, len(pixels) == 10)
+	assertPixels(t, pixels, "1,1", "3,1", "3,4", "1,4", "2,1", "1,3")
+}
+
+func TestExtCircle(t *testing.T) {
+	pixels := drawExt(t, `circle 10, 10, 5`)
+	assertPixels(t, pixels, "15,10", "5,10", "10,15", "10,5")
+	assertTrue(t, !pixels["10,10"])
+}
+
+func TestExtPolygon(t *testing.T) {
+	pixels := drawExt(t, `polygon 10, 10, 4, 4`)
+	assertPixels(t, pixels, "10,6", "14,10", "10,14", "6,10", "12,8", "8,12")
+	assertTrue(t, !pixels["10,10"])
+}
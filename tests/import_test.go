@@ -0,0 +1,368 @@
+package tests
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jtolds/pants2/app"
+	"github.com/jtolds/pants2/interp"
+	"github.com/jtolds/pants2/lib/big"
+	"github.com/jtolds/pants2/mods/std"
+)
+
+const counterMod = `
+	var n = 0
+	proc bump { n = n + 1 }
+	export n, bump`
+
+func loadWithMods(t testing.TB, mods map[string]string, code string) (
+	map[string]*interp.ValueCell, error) {
+	t.Helper()
+	a := newApp()
+	a.DefineModule("std", std.Mod)
+	assertNoErr(t, a.RunInDefaultScope(`import "std";`))
+	for name, src := range mods {
+		_, err := a.Load(name, bytes.NewReader([]byte(src)))
+		assertNoErr(t, err)
+	}
+	return a.Load("test", bytes.NewReader([]byte(code)))
+}
+
+func TestImportLive(t *testing.T) {
+	vals, err := loadWithMods(t, map[string]string{"counter.p": counterMod}, `
+		import "counter.p"
+		bump; bump
+		var seen = n
+		n = 10
+		bump
+		export seen, n`)
+	assertNoErr(t, err)
+	assertNumEqual(t, vals["seen"].Val, big.NewRat(2, 1))
+	assertNumEqual(t, vals["n"].Val, big.NewRat(11, 1))
+}
+
+func TestImportSnapshot(t *testing.T) {
+	vals, err := loadWithMods(t, map[string]string{"counter.p": counterMod}, `
+		import "counter.p" snapshot
+		bump; bump
+		var seen = n
+		export seen`)
+	assertNoErr(t, err)
+	assertNumEqual(t, vals["seen"].Val, big.NewRat(0, 1))
+}
+
+func TestImportModesAsNames(t *testing.T) {
+	vals, err := loadWithMods(t, map[string]string{"counter.p": counterMod}, `
+		var readonly = 1
+		proc snapshot x { readonly = readonly + x }
+		import "counter.p" READONLY
+		snapshot 2
+		export readonly`)
+	assertNoErr(t, err)
+	assertNumEqual(t, vals["readonly"].Val, big.NewRat(3, 1))
+}
+
+func TestImportReadOnly(t *testing.T) {
+	vals, err := loadWithMods(t, map[string]string{"counter.p": counterMod}, `
+		import "counter.p" withprefix c readonly
+		c_bump
+		var seen = c_n
+		export seen`)
+	assertNoErr(t, err)
+	assertNumEqual(t, vals["seen"].Val, big.NewRat(1, 1))
+
+	_, err = loadWithMods(t, map[string]string{"counter.p": counterMod}, `
+		import "counter.p" readonly
+		n = 3`)
+	assertTrue(t, interp.IsRuntimeError(err))
+	assertTrue(t, strings.Contains(err.Error(), "read-only"))
+}
+
+func writeFiles(t testing.TB, files map[string]string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "pants2-test")
+	assertNoErr(t, err)
+	for name, src := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		assertNoErr(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assertNoErr(t, ioutil.WriteFile(path, []byte(src), 0644))
+	}
+	return dir
+}
+
+func TestImportRelativeToFile(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.p": `
+			import "lib/util.p" withprefix a
+			import "./lib/../lib/util.p" withprefix b
+			a_n = 5
+			var seen = b_n, twice = a_double(b_n)
+			export seen, twice`,
+		"lib/util.p": `
+			import "../shared.p"
+			var n = 0
+			func double(x) { return x * two }
+			export n, double`,
+		"shared.p": `
+			var two = 2
+			export two`,
+	})
+	defer os.RemoveAll(dir)
+
+	a := newApp()
+	vals, err := a.LoadFile(filepath.Join(dir, "main.p"))
+	assertNoErr(t, err)
+	assertNumEqual(t, vals["seen"].Val, big.NewRat(5, 1))
+	assertNumEqual(t, vals["twice"].Val, big.NewRat(10, 1))
+}
+
+func TestImportSearchPath(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"prog/main.p": `
+			import "shapes.p"
+			export sides`,
+		"lib/shapes.p": `
+			var sides = 4
+			export sides`,
+	})
+	defer os.RemoveAll(dir)
+
+	a := newApp()
+	_, err := a.LoadFile(filepath.Join(dir, "prog", "main.p"))
+	assertTrue(t, interp.IsRuntimeError(err))
+
+	a = newApp()
+	a.SetSearchPath(filepath.Join(dir, "lib"))
+	vals, err := a.LoadFile(filepath.Join(dir, "prog", "main.p"))
+	assertNoErr(t, err)
+	assertNumEqual(t, vals["sides"].Val, big.NewRat(4, 1))
+}
+
+func TestImportCycleDirect(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a.p": `import "b.p"`,
+		"b.p": `
+			var x = 1
+			import "a.p"`,
+	})
+	defer os.RemoveAll(dir)
+
+	a := newApp()
+	_, err := a.LoadFile(filepath.Join(dir, "a.p"))
+	assertTrue(t, interp.IsRuntimeError(err))
+	a_p, b_p := filepath.Join(dir, "a.p"), filepath.Join(dir, "b.p")
+	assertTrue(t, strings.Contains(err.Error(),
+		"Import cycle detected: "+a_p+" -> "+b_p+" -> "+a_p))
+	assertTrue(t, strings.Contains(err.Error(),
+		`file "`+a_p+`", line 1: import "b.p"`))
+	assertTrue(t, strings.Contains(err.Error(),
+		`file "`+b_p+`", line 3: import "a.p"`))
+}
+
+func TestImportCycleIndirect(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.p":  `import "lib/a.p"`,
+		"lib/a.p": `import "b.p"`,
+		"lib/b.p": `import "../c.p"`,
+		"c.p":     `import "./lib/a.p"`,
+	})
+	defer os.RemoveAll(dir)
+
+	a := newApp()
+	_, err := a.LoadFile(filepath.Join(dir, "main.p"))
+	assertTrue(t, interp.IsRuntimeError(err))
+	a_p, b_p, c_p := filepath.Join(dir, "lib", "a.p"),
+		filepath.Join(dir, "lib", "b.p"), filepath.Join(dir, "c.p")
+	assertTrue(t, strings.Contains(err.Error(),
+		"Import cycle detected: "+a_p+" -> "+b_p+" -> "+c_p+" -> "+a_p))
+	assertTrue(t, !strings.Contains(err.Error(), "main.p ->"))
+	assertTrue(t, strings.Contains(err.Error(),
+		`file "`+c_p+`", line 1: import "./lib/a.p"`))
+
+	// a failed import must not poison later imports of the same file
+	_, err = a.LoadFile(filepath.Join(dir, "lib", "b.p"))
+	assertTrue(t, strings.Contains(err.Error(),
+		"Import cycle detected: "+b_p+" -> "+c_p+" -> "+a_p+" -> "+b_p))
+}
+
+const shapesMod = `
+	var circle = "circle", square = "square", triangle = "triangle"
+	export circle, square, triangle`
+
+func TestImportOnly(t *testing.T) {
+	vals, err := loadWithMods(t, map[string]string{"shapes.p": shapesMod}, `
+		var triangle = 3
+		import "shapes.p" only circle, square
+		var picked = circle + " " + square
+		export picked, triangle`)
+	assertNoErr(t, err)
+	assertTrue(t, vals["picked"].Val.String() == "circle square")
+	assertNumEqual(t, vals["triangle"].Val, big.NewRat(3, 1))
+}
+
+func TestImportUseAs(t *testing.T) {
+	vals, err := loadWithMods(t, map[string]string{"shapes.p": shapesMod}, `
+		var circle = 1
+		import "shapes.p" use circle as round, square
+		import "shapes.p" use triangle as tri
+		unimport "shapes.p"
+		var square = 4, tri = 3
+		export circle, square, tri`)
+	assertNoErr(t, err)
+	assertNumEqual(t, vals["circle"].Val, big.NewRat(1, 1))
+	assertNumEqual(t, vals["square"].Val, big.NewRat(4, 1))
+	assertNumEqual(t, vals["tri"].Val, big.NewRat(3, 1))
+}
+
+func TestImportWordsAsNames(t *testing.T) {
+	vals, err := loadWithMods(t, map[string]string{"shapes.p": `
+		var as = "as", only = "only"
+		export as, only`}, `
+		var use = 1
+		import "shapes.p" USE as AS alias, only
+		func add(n) { return n + use }
+		var total = add(2)
+		export total, alias, only`)
+	assertNoErr(t, err)
+	assertNumEqual(t, vals["total"].Val, big.NewRat(3, 1))
+	assertTrue(t, vals["alias"].Val.String() == "as")
+	assertTrue(t, vals["only"].Val.String() == "only")
+}
+
+func TestImportSelectErrors(t *testing.T) {
+	_, err := loadWithMods(t, map[string]string{"shapes.p": shapesMod}, `
+		var round = 1
+		import "shapes.p" use circle as round`)
+	assertTrue(t, interp.IsRuntimeError(err))
+	assertTrue(t, strings.Contains(err.Error(),
+		`Export defines "circle" (imported as "round"), but "round" already `+
+			`defined on file "test", line 2`))
+
+	_, err = loadWithMods(t, map[string]string{"shapes.p": shapesMod}, `
+		import "shapes.p" only circle, hexagon`)
+	assertTrue(t, interp.IsRuntimeError(err))
+	assertTrue(t, strings.Contains(err.Error(),
+		`Module "shapes.p" does not export "hexagon"`))
+}
+
+func TestImportInBlock(t *testing.T) {
+	vals, err := loadWithMods(t, map[string]string{
+		"shapes.p":  shapesMod,
+		"counter.p": counterMod,
+	}, `
+		var found = ""
+		proc pick {
+			import "shapes.p" only circle
+			found = found + circle
+		}
+		pick
+		pick
+		var i = 0
+		while i < 3 {
+			import "counter.p" use bump as tick readonly
+			tick
+			i = i + 1
+		}
+		if true {
+			import "shapes.p"
+			found = found + " " + square
+			unimport "shapes.p"
+			var square = "mine"
+			found = found + " " + square
+		}
+		var circle = 1, square = 2, tick = 3
+		import "counter.p" only n
+		export found, n`)
+	assertNoErr(t, err)
+	assertTrue(t, vals["found"].Val.String() == "circlecircle square mine")
+	assertNumEqual(t, vals["n"].Val, big.NewRat(3, 1))
+
+	_, err = loadWithMods(t, map[string]string{"shapes.p": shapesMod}, `
+		var circle = 1
+		proc p { import "shapes.p" }
+		p`)
+	assertTrue(t, interp.IsRuntimeError(err))
+	assertTrue(t, strings.Contains(err.Error(),
+		`Export defines "circle", but "circle" already defined`))
+
+	_, err = loadWithMods(t, map[string]string{"shapes.p": shapesMod}, `
+		import "shapes.p"
+		proc p { unimport "shapes.p" }
+		p`)
+	assertTrue(t, interp.IsRuntimeError(err))
+	assertTrue(t, strings.Contains(err.Error(), "not imported in this block"))
+}
+
+func TestImportAs(t *testing.T) {
+	vals, err := loadWithMods(t, map[string]string{
+		"shapes.p":  shapesMod,
+		"counter.p": counterMod,
+	}, `
+		var circle = 1
+		import "shapes.p" as shapes
+		import "counter.p" as counter
+		import "counter.p" as frozen snapshot
+		counter.bump
+		counter.bump
+		var picked = shapes.circle + " " + shapes.square
+		var live = counter.n, old = frozen.n
+		export circle, picked, live, old`)
+	assertNoErr(t, err)
+	assertNumEqual(t, vals["circle"].Val, big.NewRat(1, 1))
+	assertTrue(t, vals["picked"].Val.String() == "circle square")
+	assertNumEqual(t, vals["live"].Val, big.NewRat(2, 1))
+	assertNumEqual(t, vals["old"].Val, big.NewRat(0, 1))
+
+	vals, err = loadWithMods(t, map[string]string{"math.p": `
+		func double(x) { return x * 2 }
+		export double`}, `
+		import "math.p" as math
+		var r = math.double(3.5) + 1
+		export r`)
+	assertNoErr(t, err)
+	assertNumEqual(t, vals["r"].Val, big.NewRat(8, 1))
+
+	_, err = loadWithMods(t, map[string]string{"shapes.p": shapesMod}, `
+		import "shapes.p" as shapes
+		var x = shapes.hexagon`)
+	assertTrue(t, interp.IsRuntimeError(err))
+	assertTrue(t, strings.Contains(err.Error(),
+		`Module "shapes.p" does not export "hexagon"`))
+}
+
+func TestImportFromFS(t *testing.T) {
+	base := fstest.MapFS{
+		"prog/main.p": &fstest.MapFile{Data: []byte(`
+			import "../lib/shapes.p" only sides
+			import "/lib/colors.p"
+			export sides, favorite`)},
+		"lib/shapes.p": &fstest.MapFile{Data: []byte(`
+			var sides = 4
+			export sides`)},
+		"lib/colors.p": &fstest.MapFile{Data: []byte(`
+			var favorite = "red"
+			export favorite`)},
+	}
+	overlay := fstest.MapFS{
+		"lib/shapes.p": &fstest.MapFile{Data: []byte(`
+			var sides = 6
+			export sides`)},
+	}
+
+	vals, err := app.NewApp(base).LoadFile("prog/main.p")
+	assertNoErr(t, err)
+	assertNumEqual(t, vals["sides"].Val, big.NewRat(4, 1))
+	assertTrue(t, vals["favorite"].Val.String() == "red")
+
+	vals, err = app.NewApp(base, overlay).LoadFile("/prog/main.p")
+	assertNoErr(t, err)
+	assertNumEqual(t, vals["sides"].Val, big.NewRat(6, 1))
+
+	_, err = app.NewApp(base).LoadFile("lib/missing.p")
+	assertTrue(t, err != nil)
+}
@@ -2,8 +2,10 @@ package tests
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
+	"github.com/jtolds/pants2/ast"
 	"github.com/jtolds/pants2/interp"
 	"github.com/jtolds/pants2/lib/big"
 )
@@ -58,3 +60,144 @@ func TestSubproc(t *testing.T) {
 	assertNumEqual(t, testcalls[0], big.NewRat(1200, 1))
 	assertNumEqual(t, testcalls[1], big.NewRat(2000, 1))
 }
+
+func TestControlFlow(t *testing.T) {
+	vals := run(t, `
+		func firstOver(limit) {
+			var i = 0
+			loop {
+				i = i + 1
+				if i * i > limit {
+					return i
+				}
+			}
+		}
+
+		var sum = 0, i = 0
+		while i < 10 {
+			i = i + 1
+			if i % 2 == 0 {
+				next
+			}
+			var odd = i
+			if odd > 7 {
+				break
+			}
+			sum = sum + odd
+		}
+
+		var calls = 0
+		proc stopAt n {
+			var j = 0
+			while true {
+				if j == n { done }
+				j = j + 1
+				calls = calls + 1
+			}
+		}
+		stopAt 3
+
+		var first = firstOver(50)
+		export sum, i, first, calls`, nil)
+	assertNumEqual(t, vals["sum"].Val, big.NewRat(16, 1))
+	assertNumEqual(t, vals["i"].Val, big.NewRat(9, 1))
+	assertNumEqual(t, vals["first"].Val, big.NewRat(8, 1))
+	assertNumEqual(t, vals["calls"].Val, big.NewRat(3, 1))
+
+	_, err := loadWithMods(t, nil, "proc p {\n  break\n}\np")
+	assertTrue(t, err != nil)
+	assertTrue(t, strings.Contains(err.Error(), `line 2: Unexpected "break"`))
+
+	_, err = loadWithMods(t, nil, "func f() {\n  var x = 1\n}\nlog f()")
+	assertTrue(t, err != nil)
+	assertTrue(t, strings.Contains(err.Error(),
+		"line 1: Function exited with no return statement"))
+}
+
+func TestNumbers(t *testing.T) {
+	vals := run(t, `
+		var max = 9223372036854775807
+		var over = max + 1
+		var back = over - 1
+		var min = -max - 1
+		var flip = min / -1
+		var third = 1 / 3
+		var whole = third * 3
+		var square = max * max
+		var mods = (7 % -3) + (-7 % 3) * 10
+		export over, back, flip, whole, square, mods`, nil)
+	var over, square big.Rat
+	over.SetString("9223372036854775808")
+	square.SetString("85070591730234615847396907784232501249")
+	assertNumEqual(t, vals["over"].Val, &over)
+	assertNumEqual(t, vals["back"].Val, big.NewRat(9223372036854775807, 1))
+	assertNumEqual(t, vals["flip"].Val, &over)
+	assertNumEqual(t, vals["whole"].Val, big.NewRat(1, 1))
+	assertNumEqual(t, vals["square"].Val, &square)
+	assertNumEqual(t, vals["mods"].Val, big.NewRat(21, 1))
+	assertTrue(t, vals["back"].Val.String() == "9223372036854775807")
+	assertTrue(t, vals["whole"].Val.String() == "1")
+}
+
+func TestRecursiveVariables(t *testing.T) {
+	vals := run(t, `
+		func walk(n) {
+			var here = n * 10, total = here
+			if n > 0 {
+				var below = walk(n - 1)
+				total = here + below
+			}
+			return total
+		}
+		var sum = walk(4)
+		export sum`, nil)
+	assertNumEqual(t, vals["sum"].Val, big.NewRat(100, 1))
+}
+
+func TestOptimize(t *testing.T) {
+	stmts, err := ast.ParseAll(ast.NewTokenSource(ast.NewReaderLineSource(
+		"test", strings.NewReader(`
+			x = (1 + 2) * 3 - -1
+			if false { log 1 }
+			while 1 > 2 { log 2 }
+			if not true { log 3 } else { log 4 }
+			loop {
+				y = "a" + "b"
+				break
+			}
+			z = false and x
+			w = x * (2 / 0)`), nil)))
+	assertNoErr(t, err)
+	var out []string
+	for _, stmt := range interp.Optimize(stmts) {
+		out = append(out, stmt.String())
+	}
+	assertTrue(t, strings.Join(out, "") == `x = 10/1
+if true {
+log 4/1
+}
+if true {
+y = "ab"
+}
+z = false
+w = (x * (2/1 / 0/1))
+`)
+
+	for _, optimize := range []bool{false, true} {
+		a := newApp()
+		a.SetOptimize(optimize)
+		_, err := a.Load("test", strings.NewReader(`var x = 1
+var y = -(2 * 3) + x
+var s = "a" + (y - 1) * 2`))
+		assertTrue(t, err != nil)
+		assertTrue(t, strings.Contains(err.Error(),
+			"line 3: unsupported operation: string + number"))
+
+		_, err = a.Load("dead", strings.NewReader(`proc show x {}
+if false { show nosuch }
+while false { show missing }`))
+		assertTrue(t, err != nil)
+		assertTrue(t, strings.Contains(err.Error(),
+			"line 2: Variable nosuch not defined"))
+	}
+}
@@ -0,0 +1,308 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jtolds/pants2/interp"
+	"github.com/jtolds/pants2/lib/big"
+	"github.com/jtolds/pants2/mods/std"
+)
+
+func loadLimited(t *testing.T, ctx context.Context, limits interp.Limits,
+	code string) error {
+	t.Helper()
+	a := newApp()
+	a.SetLimits(limits)
+	_, err := a.LoadContext(ctx, "test", bytes.NewReader([]byte(code)))
+	return err
+}
+
+func assertLimit(t *testing.T, err error, limit interp.Limit) {
+	t.Helper()
+	var le *interp.LimitError
+	if !errors.As(err, &le) {
+		t.Fatalf("expected a limit error, got %v", err)
+	}
+	if le.Limit != limit {
+		t.Fatalf("expected limit %v, got %v: %v", limit, le.Limit, err)
+	}
+}
+
+func TestStepLimit(t *testing.T) {
+	err := loadLimited(t, context.Background(), interp.Limits{Steps: 1000},
+		`
+		var i = 0
+		loop {
+			i = i + 1
+		}`)
+	assertLimit(t, err, interp.LimitSteps)
+	assertTrue(t, strings.Contains(err.Error(), "Step limit of 1000 exceeded"))
+
+	err = loadLimited(t, context.Background(), interp.Limits{Steps: 1000},
+		`
+		var i = 0
+		while i < 10 {
+			i = i + 1
+		}`)
+	assertNoErr(t, err)
+}
+
+func TestDepthLimit(t *testing.T) {
+	err := loadLimited(t, context.Background(), interp.Limits{Depth: 50},
+		`
+		proc down n {
+			down n + 1
+		}
+		down 0`)
+	assertLimit(t, err, interp.LimitDepth)
+	assertTrue(t, strings.Contains(err.Error(),
+		"Call depth limit of 50 exceeded"))
+
+	err = loadLimited(t, context.Background(), interp.Limits{Depth: 50},
+		`
+		func fact(n) {
+			if n <= 1 { return 1 }
+			return n * fact(n - 1)
+		}
+		var x = fact(40)`)
+	assertNoErr(t, err)
+}
+
+func TestTimeLimit(t *testing.T) {
+	err := loadLimited(t, context.Background(),
+		interp.Limits{Time: 20 * time.Millisecond}, `loop {}`)
+	assertLimit(t, err, interp.LimitTime)
+}
+
+func TestTimeLimitBlocking(t *testing.T) {
+	a := newApp()
+	a.DefineModule("std", std.Mod)
+	assertNoErr(t, a.RunInDefaultScope(`import "std";`))
+	a.SetLimits(interp.Limits{Time: 100 * time.Millisecond})
+	start := time.Now()
+	_, err := a.LoadContext(context.Background(), "test",
+		strings.NewReader(`sleep 3`))
+	assertLimit(t, err, interp.LimitTime)
+	assertTrue(t, time.Since(start) < time.Second)
+}
+
+func TestContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(),
+		20*time.Millisecond)
+	defer cancel()
+	err := loadLimited(t, ctx, interp.Limits{}, `loop {}`)
+	assertLimit(t, err, interp.LimitCanceled)
+	assertTrue(t, errors.Is(err, context.DeadlineExceeded))
+}
+
+func TestLimitsCoverImports(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.p": `
+			import "count.p"
+			var j = 0
+			while j < 200 { j = j + 1 }`,
+		"count.p": `
+			var i = 0
+			while i < 200 { i = i + 1 }`,
+	})
+	defer os.RemoveAll(dir)
+
+	a := newApp()
+	a.SetLimits(interp.Limits{Steps: 1000})
+	_, err := a.LoadFileContext(context.Background(),
+		filepath.Join(dir, "main.p"))
+	assertNoErr(t, err)
+
+	// the import and the code importing it share one budget
+	a = newApp()
+	a.SetLimits(interp.Limits{Steps: 500})
+	_, err = a.LoadFileContext(context.Background(),
+		filepath.Join(dir, "main.p"))
+	assertLimit(t, err, interp.LimitSteps)
+}
+
+func TestMemoryLimit(t *testing.T) {
+	limits := interp.Limits{Memory: 1 << 20}
+	err := loadLimited(t, context.Background(), limits, `
+		var s = "pants"
+		loop {
+			s = s + s
+		}`)
+	assertLimit(t, err, interp.LimitMemory)
+	assertTrue(t, strings.Contains(err.Error(),
+		"Memory limit of 1048576 bytes exceeded"))
+
+	err = loadLimited(t, context.Background(), limits, `
+		var x = 3 / 7
+		loop {
+			x = x * x
+		}`)
+	assertLimit(t, err, interp.LimitMemory)
+
+	err = loadLimited(t, context.Background(), limits, `
+		var s = "", i = 0
+		while i < 1000 {
+			s = s + "pants"
+			i = i + 1
+		}`)
+	assertNoErr(t, err)
+}
+
+func TestMemoryHeld(t *testing.T) {
+	limits := interp.Limits{Memory: 1 << 20}
+	// each call holds its own copy of a string of about 80KB
+	err := loadLimited(t, context.Background(), limits, `
+		var s = "pants", i = 0
+		while i < 14 {
+			s = s + s
+			i = i + 1
+		}
+		proc down n, str {
+			if n > 0 { down n - 1, str + "!" }
+		}
+		down 100, s`)
+	assertLimit(t, err, interp.LimitMemory)
+	assertTrue(t, strings.Contains(err.Error(),
+		"Memory limit of 1048576 bytes exceeded, with about"))
+
+	// values no longer held don't count
+	err = loadLimited(t, context.Background(), limits, `
+		var s = "pants", i = 0, t = ""
+		while i < 14 {
+			s = s + s
+			i = i + 1
+		}
+		proc down n, str {
+			var mine = str + "!"
+			if n > 0 { down n - 1, str }
+		}
+		i = 0
+		while i < 100 {
+			t = s + "!"
+			down 2, s
+			i = i + 1
+		}
+		undefine t
+		var u = s + "?"`)
+	assertNoErr(t, err)
+
+	// nor do values procedures captured, which outlive their frames
+	err = loadLimited(t, context.Background(), limits, `
+		var s = "pants", i = 0
+		while i < 14 {
+			s = s + s
+			i = i + 1
+		}
+		func nothing() { return 0 }
+		var chain = nothing
+		proc mk {
+			var prev = chain
+			var big = s + "y"
+			func g() {
+				var z = big
+				return prev
+			}
+			chain = g
+		}
+		i = 0
+		while i < 300 {
+			mk
+			i = i + 1
+		}`)
+	assertLimit(t, err, interp.LimitMemory)
+
+	// and values kept from earlier runs do
+	a := newApp()
+	a.SetLimits(limits)
+	code := `
+		var s = "pants", i = 0
+		while i < 17 {
+			s = s + s
+			i = i + 1
+		}
+		undefine i`
+	_, err = a.Load("first", strings.NewReader(code))
+	assertNoErr(t, err)
+	_, err = a.Load("second", strings.NewReader(code))
+	assertLimit(t, err, interp.LimitMemory)
+}
+
+func TestDefaultDepthLimit(t *testing.T) {
+	_, err := loadWithMods(t, nil, `
+		func count(n) {
+			if n == 0 { return 0 }
+			return 1 + count(n - 1)
+		}
+		var x = count(1000000)`)
+	assertLimit(t, err, interp.LimitDepth)
+	assertTrue(t, strings.Contains(err.Error(), fmt.Sprintf(
+		"Call depth limit of %d exceeded", interp.DefaultDepth)))
+}
+
+func TestTailCalls(t *testing.T) {
+	vals, err := loadWithMods(t, nil, `
+		func sum(n, total) {
+			if n == 0 { return total }
+			return sum(n - 1, total + n)
+		}
+		func even(n, is) {
+			if n == 0 { return is }
+			return even(n - 1, not is)
+		}
+		var total = sum(100000, 0), parity = even(100001, true)
+		export total, parity`)
+	assertNoErr(t, err)
+	assertNumEqual(t, vals["total"].Val, big.NewRat(5000050000, 1))
+	assertTrue(t, vals["parity"].Val == interp.ValBool{Val: false})
+
+	_, err = loadWithMods(t, nil, `
+		func one(x) { return x }
+		func two(x) { return one(x, x) }
+		var y = two(1)`)
+	assertTrue(t, err != nil)
+	assertTrue(t, strings.Contains(err.Error(),
+		"line 3: Expected 1 arguments but got 2"))
+}
+
+func TestInterrupt(t *testing.T) {
+	a := newApp()
+	started := make(chan bool)
+	a.DefineModule("std", std.Mod)
+	a.DefineModule("started", func() (map[string]interp.Value, error) {
+		return map[string]interp.Value{
+			"started": interp.ProcCB(func([]interp.Value) error {
+				started <- true
+				return nil
+			})}, nil
+	})
+	assertNoErr(t, a.RunInDefaultScope(`import "std"; import "started";`))
+	go func() {
+		<-started
+		a.Interrupt()
+		<-started
+		a.Interrupt()
+	}()
+	var out bytes.Buffer
+	vals, err := a.LoadInteractive(strings.NewReader(`
+		var x = 1
+		if true { started; loop { sleep 10 } }
+		x = x + 1
+		if true { started; loop {} }
+		x = x + 1
+		export x
+		`), &out)
+	assertNoErr(t, err)
+	assertNumEqual(t, vals["x"].Val, big.NewRat(3, 1))
+	assertTrue(t, strings.Contains(out.String(),
+		`line 3: Stopped: interrupted`))
+	assertTrue(t, strings.Contains(out.String(),
+		`line 5: Stopped: interrupted`))
+}
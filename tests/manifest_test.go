@@ -0,0 +1,117 @@
+package tests
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jtolds/pants2/app"
+	"github.com/jtolds/pants2/interp"
+	"github.com/jtolds/pants2/lib/big"
+)
+
+func writeZip(t testing.TB, path string, files map[string]string) {
+	t.Helper()
+	fh, err := os.Create(path)
+	assertNoErr(t, err)
+	zw := zip.NewWriter(fh)
+	for name, src := range files {
+		w, err := zw.Create(name)
+		assertNoErr(t, err)
+		_, err = w.Write([]byte(src))
+		assertNoErr(t, err)
+	}
+	assertNoErr(t, zw.Close())
+	assertNoErr(t, fh.Close())
+}
+
+func TestManifestDependencies(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"shared/shapes/init.p": `
+			import "./sides.p"
+			var square = sides * 1
+			export square`,
+		"shared/shapes/sides.p": `
+			var sides = 4
+			export sides`,
+		"project/pants.mod": `
+			# dependencies for the test project
+			module test/project
+			require shapes 1.0.0 ../shared/shapes
+			require colors 2.1.0 ../archives/colors.zip`,
+		"project/src/main.p": `
+			import "shapes"
+			import "colors/red.p" as red
+			var color = red.name
+			export square, color`,
+	})
+	defer os.RemoveAll(dir)
+	assertNoErr(t, os.MkdirAll(filepath.Join(dir, "archives"), 0755))
+	writeZip(t, filepath.Join(dir, "archives", "colors.zip"), map[string]string{
+		"colors-2.1.0/red.p": `
+			var name = "red"
+			export name`,
+	})
+
+	load := func() (map[string]*interp.ValueCell, error) {
+		m, err := app.FindManifest(filepath.Join(dir, "project", "src"))
+		assertNoErr(t, err)
+		assertTrue(t, m != nil && m.Module == "test/project")
+		a := newApp()
+		assertNoErr(t, a.SetManifest(m, &app.Cache{Dir: filepath.Join(dir, "cache")}))
+		return a.LoadFile(filepath.Join(dir, "project", "src", "main.p"))
+	}
+
+	vals, err := load()
+	assertNoErr(t, err)
+	assertNumEqual(t, vals["square"].Val, big.NewRat(4, 1))
+	assertTrue(t, vals["color"].Val.String() == "red")
+	_, err = os.Stat(filepath.Join(dir, "cache", "colors@2.1.0", "red.p"))
+	assertNoErr(t, err)
+
+	m, err := app.ReadManifest(filepath.Join(dir, "project", "pants.mod"))
+	assertNoErr(t, err)
+	assertNoErr(t, app.Vendor(m, &app.Cache{Dir: filepath.Join(dir, "cache")}))
+
+	// a failed vendor leaves the old vendor directory alone
+	broken := *m
+	broken.Requires = append(append([]app.Require(nil), m.Requires...),
+		app.Require{Name: "missing", Version: "1.0.0", Source: "../nowhere"})
+	assertTrue(t, app.Vendor(&broken,
+		&app.Cache{Dir: filepath.Join(dir, "cache")}) != nil)
+	_, err = os.Stat(filepath.Join(dir, "project", "vendor", "shapes", "init.p"))
+	assertNoErr(t, err)
+	leftover, err := filepath.Glob(filepath.Join(dir, "project", ".vendor-*"))
+	assertNoErr(t, err)
+	assertTrue(t, len(leftover) == 0)
+
+	assertNoErr(t, os.RemoveAll(filepath.Join(dir, "cache")))
+	assertNoErr(t, os.RemoveAll(filepath.Join(dir, "shared")))
+	assertNoErr(t, os.RemoveAll(filepath.Join(dir, "archives")))
+
+	vals, err = load()
+	assertNoErr(t, err)
+	assertNumEqual(t, vals["square"].Val, big.NewRat(4, 1))
+	assertTrue(t, vals["color"].Val.String() == "red")
+}
+
+func TestManifestErrors(t *testing.T) {
+	_, err := app.ParseManifest(".", strings.NewReader(`
+		require shapes 1.0.0`))
+	assertTrue(t, err != nil && strings.Contains(err.Error(), "line 2"))
+	_, err = app.ParseManifest(".", strings.NewReader(`
+		require ../shapes 1.0.0 ./shapes`))
+	assertTrue(t, err != nil)
+	_, err = app.ParseManifest(".", strings.NewReader(`
+		require shapes 1.0.0 ./shapes
+		require shapes 1.0.1 ./shapes`))
+	assertTrue(t, err != nil)
+
+	m, err := app.ParseManifest(".", strings.NewReader(`
+		require shapes 1.0.0 ./shapes`))
+	assertNoErr(t, err)
+	assertTrue(t, app.NewApp(fstest.MapFS{}).SetManifest(m, nil) != nil)
+}
@@ -0,0 +1,149 @@
+package tests
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jtolds/pants2/app"
+	"github.com/jtolds/pants2/ast"
+	"github.com/jtolds/pants2/interp"
+)
+
+func TestSyntaxErrorsBeforeRunning(t *testing.T) {
+	ran := false
+	a := newApp()
+	a.DefineModule("_test", func() (map[string]interp.Value, error) {
+		return map[string]interp.Value{
+			"mark": interp.ProcCB(func([]interp.Value) error {
+				ran = true
+				return nil
+			})}, nil
+	})
+	assertNoErr(t, a.RunInDefaultScope(`import "_test";`))
+	_, err := a.Load("test", bytes.NewReader([]byte(`
+		var x = 1
+		mark
+		var = 2
+		x = = 4
+		mark`)))
+	assertTrue(t, ast.IsSyntaxError(err))
+	assertTrue(t, !ran)
+	errs, ok := err.(ast.SyntaxErrors)
+	assertTrue(t, ok && len(errs) == 2)
+	assertTrue(t, strings.Contains(errs[0].Error(), "line 4"))
+	assertTrue(t, strings.Contains(errs[1].Error(), "line 5"))
+}
+
+func TestSyntaxErrorRecovery(t *testing.T) {
+	_, err := ast.ParseAll(ast.NewTokenSource(ast.NewReaderLineSource("test",
+		strings.NewReader(`proc draw x, y {
+  var a = = 1
+  if x ? y {
+    log "ok"
+  }
+  log "a\qb", 2
+}
+var = 3; var b = 4
+log (b
+`), nil)))
+	errs, ok := err.(ast.SyntaxErrors)
+	assertTrue(t, ok)
+	type pos struct{ line, char int }
+	var got []pos
+	for _, serr := range errs {
+		_, line, char := serr.Pos()
+		got = append(got, pos{line, char})
+	}
+	expected := []pos{{2, 11}, {3, 8}, {6, 9}, {8, 5}, {9, 1}}
+	assertTrue(t, len(got) == len(expected))
+	for i := range expected {
+		assertTrue(t, got[i] == expected[i])
+	}
+	assertTrue(t, strings.Contains(errs[1].Msg(), `"?"`))
+}
+
+func TestUnclosedBlock(t *testing.T) {
+	_, err := loadWithMods(t, nil, "proc foo {\n  var x = 1\n")
+	assertTrue(t, ast.IsSyntaxError(err))
+	assertTrue(t, strings.Contains(err.Error(), "Expecting '}'"))
+}
+
+const everySyntax = `import "shapes.p" withprefix s readonly
+import "counter.p" use n as count, bump
+unimport "counter.p"
+func half(x) { return x / 2 }
+proc show a, b {
+  if not (a < b) and b != 1 or -a >= 3 {
+    log a.b, half(b)[1]
+  } else {
+    undefine a
+  }
+  while true { next; break; done }
+}
+var x = 1, y, z = "q"
+x = x % 3 * (2.5 + 1/3)
+reload "shapes.p"
+export x
+`
+
+func TestEncodeDecode(t *testing.T) {
+	stmts, err := ast.ParseAll(ast.NewTokenSource(ast.NewReaderLineSource(
+		"test", strings.NewReader(everySyntax), nil)))
+	assertNoErr(t, err)
+	decoded, err := ast.Decode(ast.Encode(stmts))
+	assertNoErr(t, err)
+	assertTrue(t, len(decoded) == len(stmts))
+	for i := range stmts {
+		assertTrue(t, decoded[i].String() == stmts[i].String())
+	}
+	ret := decoded[3].(*ast.StmtFuncDef).Body[0].(*ast.StmtReturn)
+	op := ret.Val.(*ast.ExprOp)
+	assertTrue(t, op.Token == op.Op)
+	assertTrue(t, op.Token.Line.Lineno == 4 && op.Token.Start == 24)
+	assertTrue(t, op.Token.Line.Line == "func half(x) { return x / 2 }")
+
+	_, err = ast.Decode(ast.Encode(stmts)[:50])
+	assertTrue(t, err != nil)
+}
+
+func TestParseCache(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.p": "var x = 1\nvar y = x / 0\n"})
+	defer os.RemoveAll(dir)
+	cache := &app.ParseCache{Dir: filepath.Join(dir, "cache")}
+	for i := 0; i < 2; i++ {
+		a := newApp()
+		a.SetParseCache(cache)
+		_, err := a.LoadFile(filepath.Join(dir, "main.p"))
+		assertTrue(t, err != nil)
+		assertTrue(t, strings.Contains(err.Error(),
+			"line 2: Division by zero\n    var y = x / 0\n              ^"))
+	}
+	entries, err := filepath.Glob(filepath.Join(dir, "cache", "*", "*"))
+	assertNoErr(t, err)
+	assertTrue(t, len(entries) == 1)
+
+	// a damaged entry is parsed again
+	assertNoErr(t, ioutil.WriteFile(entries[0], []byte("junk"), 0644))
+	stmts, err := cache.Parse(filepath.Join(dir, "main.p"),
+		[]byte("var x = 1\nvar y = x / 0\n"))
+	assertNoErr(t, err)
+	assertTrue(t, len(stmts) == 2)
+
+	// and so is one missing something the parser always fills in
+	op := stmts[1].(*ast.StmtVar).Vars[0].Expr.(*ast.ExprOp)
+	op.Right = nil
+	assertNoErr(t, ioutil.WriteFile(entries[0], ast.Encode(stmts), 0644))
+	stmts, err = cache.Parse(filepath.Join(dir, "main.p"),
+		[]byte("var x = 1\nvar y = x / 0\n"))
+	assertNoErr(t, err)
+	op = stmts[1].(*ast.StmtVar).Vars[0].Expr.(*ast.ExprOp)
+	assertTrue(t, op.Right != nil)
+
+	_, err = cache.Parse("bad.p", []byte("var = 1\n"))
+	assertTrue(t, ast.IsSyntaxError(err))
+}
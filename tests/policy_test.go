@@ -0,0 +1,146 @@
+package tests
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jtolds/pants2/app"
+	"github.com/jtolds/pants2/interp"
+	"github.com/jtolds/pants2/lib/big"
+	"github.com/jtolds/pants2/mods/std"
+)
+
+func TestPolicyModules(t *testing.T) {
+	a := newApp()
+	a.DefineModule("std", std.Mod)
+	a.DefineModule("extra", func() (map[string]interp.Value, error) {
+		return map[string]interp.Value{"answer": interp.NewInt(42)}, nil
+	})
+	a.DefineModuleSource("extra/src", []byte("var n = 1\nexport n"))
+	assertNoErr(t, a.SetPolicy(app.Policy{Modules: []string{"std"}}))
+
+	_, err := a.Load("ok", bytes.NewReader([]byte(`import "std"`)))
+	assertNoErr(t, err)
+	_, err = a.Load("builtin", bytes.NewReader([]byte(`import "extra"`)))
+	assertTrue(t, err != nil)
+	assertTrue(t, strings.Contains(err.Error(),
+		`line 1: Importing module "extra" is not allowed`))
+	_, err = a.Load("source", bytes.NewReader([]byte(`import "extra/src"`)))
+	assertTrue(t, err != nil)
+	assertTrue(t, strings.Contains(err.Error(),
+		`Importing module "extra/src" is not allowed`))
+}
+
+func TestPolicyDirs(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"prog/main.p": `
+			import "lib/shapes.p"
+			export sides`,
+		"prog/lib/shapes.p": `
+			var sides = 4
+			export sides`,
+		"prog/escape.p": `
+			import "../secret.p"`,
+		"prog/probe.p": `
+			import "../nosuch.p"`,
+		"prog/linked.p": `
+			import "link.p"`,
+		"secret.p": `
+			var password = "hunter2"
+			export password`,
+	})
+	defer os.RemoveAll(dir)
+
+	a := newApp()
+	assertNoErr(t, a.SetPolicy(app.Policy{
+		Dirs: []string{filepath.Join(dir, "prog")}}))
+	vals, err := a.LoadFile(filepath.Join(dir, "prog", "main.p"))
+	assertNoErr(t, err)
+	assertNumEqual(t, vals["sides"].Val, big.NewRat(4, 1))
+
+	_, err = a.LoadFile(filepath.Join(dir, "prog", "escape.p"))
+	assertTrue(t, err != nil)
+	assertTrue(t, strings.Contains(err.Error(),
+		`line 2: Importing file "`))
+	assertTrue(t, strings.Contains(err.Error(), "is not allowed"))
+
+	// files outside the directories are refused whether they exist or not
+	_, err = a.LoadFile(filepath.Join(dir, "prog", "probe.p"))
+	assertTrue(t, err != nil)
+	assertTrue(t, strings.Contains(err.Error(),
+		`line 2: Importing file "`))
+	assertTrue(t, strings.Contains(err.Error(), "is not allowed"))
+
+	// and so are symlinks inside them that lead outside
+	assertNoErr(t, os.Symlink(filepath.Join(dir, "secret.p"),
+		filepath.Join(dir, "prog", "link.p")))
+	_, err = a.LoadFile(filepath.Join(dir, "prog", "linked.p"))
+	assertTrue(t, err != nil)
+	assertTrue(t, strings.Contains(err.Error(),
+		`line 2: Importing file "`))
+	assertTrue(t, strings.Contains(err.Error(), "is not allowed"))
+
+	a = newApp()
+	assertNoErr(t, a.SetPolicy(app.Policy{Dirs: []string{}}))
+	_, err = a.LoadFile(filepath.Join(dir, "prog", "main.p"))
+	assertTrue(t, err != nil)
+	assertTrue(t, strings.Contains(err.Error(), "is not allowed"))
+
+	assertTrue(t, newApp().SetPolicy(app.Policy{
+		Dirs: []string{filepath.Join(dir, "missing")}}) != nil)
+
+	a = app.NewApp(fstest.MapFS{
+		"prog/main.p": &fstest.MapFile{Data: []byte(`
+			import "/lib/shapes.p"
+			import "/libs/nosuch.p"`)},
+		"lib/shapes.p":  &fstest.MapFile{Data: []byte(`var a = 1`)},
+		"libs/shapes.p": &fstest.MapFile{Data: []byte(`var b = 1`)},
+	})
+	assertNoErr(t, a.SetPolicy(app.Policy{Dirs: []string{"prog", "lib"}}))
+	_, err = a.LoadFile("prog/main.p")
+	assertTrue(t, err != nil)
+	assertTrue(t, strings.Contains(err.Error(),
+		`line 3: Importing file "libs/nosuch.p" is not allowed, `+
+			`only files in prog, lib may be imported`))
+}
+
+func TestPolicyDisabled(t *testing.T) {
+	a := newApp()
+	a.DefineModule("std", std.Mod)
+	assertNoErr(t, a.SetPolicy(app.Policy{
+		Disabled: []string{"input", "sleep"}}))
+	assertNoErr(t, a.RunInDefaultScope(`import "std";`))
+
+	_, err := a.Load("sleepy", bytes.NewReader([]byte(`
+		var now = time()
+		sleep 0`)))
+	assertTrue(t, err != nil)
+	assertTrue(t, strings.Contains(err.Error(),
+		`line 3: sleep: sleep is disabled by this App's policy`))
+
+	_, err = a.Load("nosy", bytes.NewReader([]byte(`
+		var name = input("name?")`)))
+	assertTrue(t, err != nil)
+	assertTrue(t, strings.Contains(err.Error(),
+		`line 2: input: input is disabled by this App's policy`))
+
+	// the policy applies to modules imported before it was set, and can be
+	// lifted again
+	a = newApp()
+	a.DefineModule("std", std.Mod)
+	assertNoErr(t, a.RunInDefaultScope(`import "std";`))
+	_, err = a.Load("before", bytes.NewReader([]byte(`sleep 0`)))
+	assertNoErr(t, err)
+	assertNoErr(t, a.SetPolicy(app.Policy{Disabled: []string{"sleep"}}))
+	_, err = a.Load("after", bytes.NewReader([]byte(`sleep 0`)))
+	assertTrue(t, err != nil)
+	assertTrue(t, strings.Contains(err.Error(),
+		`line 1: sleep: sleep is disabled by this App's policy`))
+	assertNoErr(t, a.SetPolicy(app.Policy{}))
+	_, err = a.Load("lifted", bytes.NewReader([]byte(`sleep 0`)))
+	assertNoErr(t, err)
+}
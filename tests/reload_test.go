@@ -0,0 +1,165 @@
+package tests
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jtolds/pants2/interp"
+	"github.com/jtolds/pants2/lib/big"
+)
+
+func TestReload(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"counter.p": `
+		var n = 0, label = "counter"
+		proc bump { n = n + 1 }
+		export n, bump, label`})
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "counter.p")
+
+	a := newApp()
+	a.DefineModule("_test", func() (map[string]interp.Value, error) {
+		return map[string]interp.Value{
+			"rewrite": interp.ProcCB(func([]interp.Value) error {
+				return ioutil.WriteFile(path, []byte(`
+					var n = 100
+					proc bump { n = n + 10 }
+					func twice(x) { return x * 2 }
+					export n, bump, twice`), 0644)
+			})}, nil
+	})
+	var out bytes.Buffer
+	vals, err := a.LoadInteractive(strings.NewReader(fmt.Sprintf(`
+		import "_test"
+		import %q
+		import %q as counter
+		var shown = 0
+		proc show { shown = n }
+		bump; bump
+		rewrite
+		reload %q
+		bump
+		show
+		var doubled = twice(n), viaNs = counter.twice(1)
+		var missing = label
+		export shown, doubled, viaNs
+		`, path, path, path)), &out)
+	assertNoErr(t, err)
+	assertNumEqual(t, vals["shown"].Val, big.NewRat(110, 1))
+	assertNumEqual(t, vals["doubled"].Val, big.NewRat(220, 1))
+	assertNumEqual(t, vals["viaNs"].Val, big.NewRat(2, 1))
+	assertTrue(t, strings.Contains(out.String(), fmt.Sprintf(
+		"Reloaded %q: added twice; removed label; changed bump, n", path)))
+	assertTrue(t, strings.Contains(out.String(), "label not defined"))
+}
+
+func TestReloadErrors(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"counter.p": counterMod})
+	defer os.RemoveAll(dir)
+	_, err := loadWithMods(t, nil, fmt.Sprintf(`reload %q`,
+		filepath.Join(dir, "counter.p")))
+	assertTrue(t, interp.IsRuntimeError(err))
+	assertTrue(t, strings.Contains(err.Error(), "not imported"))
+
+	_, err = loadWithMods(t, nil, `reload "std"`)
+	assertTrue(t, interp.IsRuntimeError(err))
+	assertTrue(t, strings.Contains(err.Error(), "can't be reloaded"))
+
+	_, err = loadWithMods(t, map[string]string{"counter.p": counterMod}, `
+		import "counter.p"
+		reload "counter.p"`)
+	assertTrue(t, interp.IsRuntimeError(err))
+	assertTrue(t, strings.Contains(err.Error(), "no file to reload"))
+}
+
+func TestReloadMessages(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"counter.p": counterMod,
+		"main.p": `
+			import "counter.p"
+			reload "counter.p"`,
+	})
+	defer os.RemoveAll(dir)
+
+	a := newApp()
+	var out bytes.Buffer
+	a.SetMessages(&out)
+	_, err := a.LoadFile(filepath.Join(dir, "main.p"))
+	assertNoErr(t, err)
+	assertTrue(t, strings.Contains(out.String(),
+		`Reloaded "counter.p": no changes`))
+}
+
+func TestReloadFailed(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"counter.p": counterMod})
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "counter.p")
+
+	a := newApp()
+	a.DefineModule("_test", func() (map[string]interp.Value, error) {
+		return map[string]interp.Value{
+			"rewrite": interp.ProcCB(func([]interp.Value) error {
+				return ioutil.WriteFile(path, []byte(`
+					var n = 100
+					proc bump { n = n + 10 }
+					var broken = 1 / 0
+					export n, bump`), 0644)
+			})}, nil
+	})
+	var out bytes.Buffer
+	vals, err := a.LoadInteractive(strings.NewReader(fmt.Sprintf(`
+		import "_test"
+		import %q
+		bump
+		rewrite
+		reload %q
+		bump
+		var seen = n
+		export seen
+		`, path, path)), &out)
+	assertNoErr(t, err)
+	assertTrue(t, strings.Contains(out.String(), "Division by zero"))
+	assertNumEqual(t, vals["seen"].Val, big.NewRat(2, 1))
+}
+
+func TestReloadBlockImport(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"counter.p": `
+		var n = 1, label = "counter"
+		export n, label`})
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "counter.p")
+
+	a := newApp()
+	a.DefineModule("_test", func() (map[string]interp.Value, error) {
+		return map[string]interp.Value{
+			"rewrite": interp.ProcCB(func([]interp.Value) error {
+				return ioutil.WriteFile(path, []byte(`
+					var n = 100
+					func twice(x) { return x * 2 }
+					export n, twice`), 0644)
+			})}, nil
+	})
+	var out bytes.Buffer
+	vals, err := a.LoadInteractive(strings.NewReader(fmt.Sprintf(`
+		import "_test"
+		var before = 0, after = 0
+		proc check {
+			import %q
+			before = n
+			rewrite
+			reload %q
+			after = twice(n)
+			var missing = label
+		}
+		check
+		export before, after
+		`, path, path)), &out)
+	assertNoErr(t, err)
+	assertNumEqual(t, vals["before"].Val, big.NewRat(1, 1))
+	assertNumEqual(t, vals["after"].Val, big.NewRat(200, 1))
+	assertTrue(t, strings.Contains(out.String(), "label not defined"))
+}
@@ -2,6 +2,7 @@ package tests
 
 import (
 	"bytes"
+	"flag"
 	"testing"
 
 	"github.com/jtolds/pants2/app"
@@ -10,6 +11,15 @@ import (
 	"github.com/jtolds/pants2/mods/std"
 )
 
+var optimize = flag.Bool("optimize", false,
+	"run the tests with the optimizer turned on")
+
+func newApp() *app.App {
+	a := app.NewApp()
+	a.SetOptimize(*optimize)
+	return a
+}
+
 func assertNoErr(t testing.TB, err error) {
 	t.Helper()
 	if err != nil {
@@ -25,7 +35,7 @@ func assertTrue(t testing.TB, val bool) {
 }
 
 func run(t testing.TB, code string, invals map[string]interp.Value) map[string]*interp.ValueCell {
-	a := app.NewApp()
+	a := newApp()
 	a.DefineModule("std", std.Mod)
 	a.RunInDefaultScope(`import "std";`)
 	if invals != nil {
@@ -39,6 +49,6 @@ func run(t testing.TB, code string, invals map[string]interp.Value) map[string]*
 
 func assertNumEqual(t testing.TB, arg interp.Value, expected *big.Rat) {
 	t.Helper()
-	v := arg.(interp.ValNumber).Val
+	v := arg.(interp.ValNumber).Rat()
 	assertTrue(t, v.Cmp(expected) == 0)
 }